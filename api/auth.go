@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// authDomain is prepended to every signed challenge so a login signature
+// can never be mistaken for a paste signature or anything else signed
+// with the same identity key.
+const authDomain = "DropKey-Auth-v1\x00"
+
+// Error codes the server uses to explain why authentication failed.
+const (
+	codeClockSkew        = "clock_skew"
+	codeNonceExpired     = "nonce_expired"
+	codeNonceReused      = "nonce_reused"
+	codeNonceInvalid     = "nonce_invalid"
+	codeInvalidSignature = "invalid_signature"
+)
+
+var (
+	ErrClockSkew    = errors.New("clock skew between client and server")
+	ErrInvalidNonce = errors.New("challenge expired or was already used")
+	ErrBadSignature = errors.New("signature was rejected by the server")
+)
+
+// AuthError is returned when the server refuses a login. Kind is one of
+// ErrClockSkew, ErrInvalidNonce or ErrBadSignature so callers can match it
+// with errors.Is.
+type AuthError struct {
+	Kind    error
+	Status  int
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	if e.Message == "" {
+		return e.Kind.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Kind
+}
+
+type ChallengeMsg struct {
+	UserID string
+	ChallengeResponse
+}
+
+// ChallengeMessage returns the exact bytes a client signs to answer a
+// nonce. The user ID is included so a signature for one account cannot be
+// submitted for another.
+func ChallengeMessage(userID, nonce string) []byte {
+	return []byte(authDomain + userID + "\x00" + nonce)
+}
+
+// RequestChallenge asks the server for a one-time nonce bound to the user.
+func RequestChallenge(ctx context.Context, id string) tea.Cmd {
+	return func() tea.Msg {
+		jsonBody, err := json.Marshal(ChallengeRequest{ID: id})
+		if err != nil {
+			return ErrMsg(fmt.Errorf("failed to marshal request: %w", err))
+		}
+
+		// an unanswered nonce just expires, asking again is harmless
+		resp, err := postJSON(ctx, Timeouts.Auth, retryAll, "/api/users/challenge", jsonBody)
+		if err != nil {
+			return ErrMsg(requestErr(fmt.Sprintf("failed to request challenge for userID : %v", id), err))
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return ErrMsg(authErrorFromResponse(resp))
+		}
+
+		var challenge ChallengeResponse
+		if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+			return ErrMsg(fmt.Errorf("failed to decode challenge response: %w", err))
+		}
+		if challenge.Nonce == "" {
+			return ErrMsg(&AuthError{Kind: ErrInvalidNonce, Status: resp.StatusCode, Message: "server sent an empty nonce"})
+		}
+
+		return ChallengeMsg{
+			UserID:            id,
+			ChallengeResponse: challenge,
+		}
+	}
+}
+
+// authErrorFromResponse turns a failed auth or challenge response into a
+// typed AuthError when the server says why, and a plain error otherwise.
+func authErrorFromResponse(resp *http.Response) error {
+	bodyBytes, _ := io.ReadAll(resp.Body)
+
+	var errResp ErrorResponse
+	_ = json.Unmarshal(bodyBytes, &errResp)
+
+	var kind error
+	switch errResp.Code {
+	case codeClockSkew:
+		kind = ErrClockSkew
+	case codeNonceExpired, codeNonceReused, codeNonceInvalid:
+		kind = ErrInvalidNonce
+	case codeInvalidSignature:
+		kind = ErrBadSignature
+	default:
+		return fmt.Errorf("auth request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return &AuthError{
+		Kind:    kind,
+		Status:  resp.StatusCode,
+		Message: errResp.Message,
+	}
+}
@@ -2,24 +2,99 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"Drop-Key-TUI/crypt"
-
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-const backendURL = "http://localhost:8081"
+// DefaultBackendURL is where the DropKey server listens in development,
+// and the address `dropkey dev-server` binds to.
+const DefaultBackendURL = "http://localhost:8081"
+
+// backendURL can be pointed elsewhere with DROPKEY_BACKEND_URL or, in
+// tests, SetBackendURL.
+var backendURL = backendFromEnv()
+
+func backendFromEnv() string {
+	if u := os.Getenv("DROPKEY_BACKEND_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return DefaultBackendURL
+}
+
+// SetBackendURL changes the server every request goes to. It is meant to
+// be called before any request is made, e.g. with an httptest server URL.
+func SetBackendURL(u string) {
+	backendURL = strings.TrimSuffix(u, "/")
+}
 
 type ErrMsg error
 
-var httpClient = &http.Client{
-	Timeout: 5 * time.Second,
+// ErrUnauthorized is returned when the server rejects the bearer token.
+var ErrUnauthorized = errors.New("session expired, please login again")
+
+// GetPaste reports these for a 400, a 404 and a 410.
+var (
+	ErrInvalidPasteID = errors.New("invalid paste ID")
+	ErrPasteNotFound  = errors.New("Paste not found")
+	ErrPasteExpired   = errors.New("Paste has expired")
+)
+
+// ErrCanceled is returned when the caller cancelled the request's context,
+// the view that started it has moved on. ErrTimeout is wrapped when the
+// request ran out of time.
+var (
+	ErrCanceled = errors.New("request cancelled")
+	ErrTimeout  = errors.New("request timed out")
+)
+
+// Timeouts bound each attempt of a kind of request on top of the caller's
+// context, see Retries. Streamed uploads and downloads are only bounded by
+// the caller's context and the wait for response headers, see streamClient.
+var Timeouts = struct {
+	Auth   time.Duration
+	List   time.Duration
+	Fetch  time.Duration
+	Upload time.Duration
+}{
+	Auth:   10 * time.Second,
+	List:   15 * time.Second,
+	Fetch:  30 * time.Second,
+	Upload: 2 * time.Minute,
+}
+
+// httpClient has no overall timeout, every request carries its own in
+// its context
+var httpClient = &http.Client{}
+
+// withTimeout bounds ctx by d, a zero d leaves it as is
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// requestErr tells a request cut short by its context apart from one that
+// failed on the network
+func requestErr(what string, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%s: %w", what, ErrTimeout)
+	}
+	return fmt.Errorf("%s: %w", what, err)
 }
 
 type PasteCreatedMsg struct {
@@ -27,16 +102,58 @@ type PasteCreatedMsg struct {
 	CreatePasteResponse
 }
 
+// PasteCreateFailedMsg is an upload that did not go through. TempID says
+// which one, so a form that moved on can tell it apart from its own.
+// Rejected is set when no paste can exist: the request never left or the
+// server answered 4xx. After a network error or a 5xx it may have stored
+// the paste anyway.
+type PasteCreateFailedMsg struct {
+	TempID   string
+	Err      error
+	Rejected bool
+}
+
+func (m PasteCreateFailedMsg) Error() string { return m.Err.Error() }
+
+func (m PasteCreateFailedMsg) Unwrap() error { return m.Err }
+
+func createFailed(tempID string, err error) tea.Msg {
+	return PasteCreateFailedMsg{TempID: tempID, Err: err}
+}
+
+func createRejected(tempID string, err error) tea.Msg {
+	return PasteCreateFailedMsg{TempID: tempID, Err: err, Rejected: true}
+}
+
+func isRejection(status int) bool {
+	return status >= 400 && status < 500
+}
+
+// PasteListFetchedMsg carries the pastes as the server lists them, still
+// encrypted. Titles are decrypted by the caller.
 type PasteListFetchedMsg struct {
-	List   []Paste
-	Titles []string
+	List []Paste
+}
+
+// PastePageFetchedMsg is one page of the list. Cursor is the one it was
+// asked for with, so a page that arrives after a refresh can be told apart.
+type PastePageFetchedMsg struct {
+	PublicKey string
+	Cursor    string
+	PastePage
 }
 
 type PasteFetchedMsg struct {
 	Paste
 }
 
-func RegisterUser(pubKeyB64 string) tea.Cmd {
+// UnauthorizedMsg is returned by authenticated calls when the server
+// answers 401. Retry re-issues the same request with a fresh token.
+type UnauthorizedMsg struct {
+	Retry func(token string) tea.Cmd
+}
+
+func RegisterUser(ctx context.Context, pubKeyB64 string) tea.Cmd {
 	return func() tea.Msg {
 		reqBody := RegisterUserRequest{PublicKey: pubKeyB64}
 		jsonBody, err := json.Marshal(reqBody)
@@ -44,10 +161,11 @@ func RegisterUser(pubKeyB64 string) tea.Cmd {
 			return ErrMsg(fmt.Errorf("failed to marshal request: %w", err))
 		}
 
-		resp, err := httpClient.Post(fmt.Sprintf("%s/api/users", backendURL), "application/json", bytes.NewBuffer(jsonBody))
+		resp, err := postJSON(ctx, Timeouts.Auth, retryBusy, "/api/users", jsonBody)
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to make register User request"))
+			return ErrMsg(requestErr("failed to make register User request", err))
 		}
+		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusCreated {
 			bodyBytes, _ := io.ReadAll(resp.Body)
@@ -62,22 +180,23 @@ func RegisterUser(pubKeyB64 string) tea.Cmd {
 	}
 }
 
-func AuthenticateUser(reqBody AuthRequest) tea.Cmd {
+func AuthenticateUser(ctx context.Context, reqBody AuthRequest) tea.Cmd {
 	return func() tea.Msg {
 		jsonBody, err := json.Marshal(reqBody)
 		if err != nil {
 			return ErrMsg(fmt.Errorf("failed to marshal request: %w", err))
 		}
 
-		resp, err := httpClient.Post(fmt.Sprintf("%s/api/users/auth", backendURL), "application/json", bytes.NewBuffer(jsonBody))
+		// the challenge is single use, only retried when the server did
+		// not look at it
+		resp, err := postJSON(ctx, Timeouts.Auth, retryBusy, "/api/users/auth", jsonBody)
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to authenticate user userID : %v", reqBody.ID))
+			return ErrMsg(requestErr(fmt.Sprintf("failed to authenticate user userID : %v", reqBody.ID), err))
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			return ErrMsg(fmt.Errorf("auth request failed with status %d: %s", resp.StatusCode, string(bodyBytes)))
+			return ErrMsg(authErrorFromResponse(resp))
 		}
 
 		var authResponse AuthResponse
@@ -89,35 +208,52 @@ func AuthenticateUser(reqBody AuthRequest) tea.Cmd {
 	}
 }
 
-func CreatePaste(reqBody PasteRequest, token, tempID string) tea.Cmd {
+// CreatePaste uploads a sealed paste. tempID, the ID its key is stored
+// under until the server assigns one, is sent as the idempotency key. Only
+// the dev server is known to honour it, so a create is only retried when
+// the server turned it away, a lost answer could otherwise store a copy.
+func CreatePaste(ctx context.Context, reqBody PasteRequest, token, tempID string) tea.Cmd {
 	return func() tea.Msg {
 		jsonBody, err := json.Marshal(reqBody)
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to marshal request: %w", err))
+			return createRejected(tempID, fmt.Errorf("failed to marshal request: %w", err))
 		}
 
-		req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/pastes", backendURL), bytes.NewBuffer(jsonBody))
+		resp, err := send(ctx, httpClient, Timeouts.Upload, retryBusy, func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/pastes", backendURL), bytes.NewReader(jsonBody))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", tempID)
+			return req, nil
+		})
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to generate create paste request"))
+			return createFailed(tempID, requestErr("failed to make create paste request", err))
 		}
+		defer resp.Body.Close()
 
-		req.Header.Set("Authorization", "Bearer "+token)
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to make create paste request"))
+		if resp.StatusCode == http.StatusUnauthorized {
+			return UnauthorizedMsg{
+				Retry: func(token string) tea.Cmd {
+					return CreatePaste(ctx, reqBody, token, tempID)
+				},
+			}
 		}
-		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusCreated {
 			bodyBytes, _ := io.ReadAll(resp.Body)
-			return ErrMsg(fmt.Errorf("create paste request failed with status %d: %s", resp.StatusCode, string(bodyBytes)))
+			err := fmt.Errorf("create paste request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+			if isRejection(resp.StatusCode) {
+				return createRejected(tempID, err)
+			}
+			return createFailed(tempID, err)
 		}
 
 		var pasteResponse CreatePasteResponse
 		if err := json.NewDecoder(resp.Body).Decode(&pasteResponse); err != nil {
-			return ErrMsg(fmt.Errorf("failed to decode create paste response: %w", err))
+			return createFailed(tempID, fmt.Errorf("failed to decode create paste response: %w", err))
 		}
 
 		return PasteCreatedMsg{
@@ -127,74 +263,118 @@ func CreatePaste(reqBody PasteRequest, token, tempID string) tea.Cmd {
 	}
 }
 
-func GetPastes(publicKey string) tea.Cmd {
+// PastePageSize is how many pastes are asked for per page
+const PastePageSize = 50
+
+// GetPastesPage fetches one page of the pastes signed with publicKey,
+// starting after cursor. An empty cursor is the first page.
+func GetPastesPage(ctx context.Context, publicKey, cursor string, limit int) tea.Cmd {
 	return func() tea.Msg {
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/pastes?public_key=%s", backendURL, url.QueryEscape(publicKey)), nil)
+		page, err := fetchPastesPage(ctx, publicKey, cursor, limit)
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to create request: %w", err))
+			return ErrMsg(err)
 		}
+		return PastePageFetchedMsg{PublicKey: publicKey, Cursor: cursor, PastePage: page}
+	}
+}
 
-		resp, err := httpClient.Do(req)
+// GetPastes fetches every page for publicKey, for callers that need the
+// whole list at once such as the key doctor.
+func GetPastes(ctx context.Context, publicKey string) tea.Cmd {
+	return func() tea.Msg {
+		var all []Paste
+		err := EachPastePage(ctx, publicKey, func(pastes []Paste) error {
+			all = append(all, pastes...)
+			return nil
+		})
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to make request: %w", err))
+			return ErrMsg(err)
 		}
-		defer resp.Body.Close()
+		return PasteListFetchedMsg{List: all}
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			return ErrMsg(fmt.Errorf("get pastes failed with status %d: %s", resp.StatusCode, string(bodyBytes)))
+// EachPastePage walks the pastes of publicKey a page at a time, so a
+// caller that looks at every paste only holds one page. It stops at the
+// first error, fn's included.
+func EachPastePage(ctx context.Context, publicKey string, fn func(pastes []Paste) error) error {
+	cursor := ""
+	for {
+		page, err := fetchPastesPage(ctx, publicKey, cursor, PastePageSize)
+		if err != nil {
+			return err
 		}
-
-		var pastes []Paste
-		if err := json.NewDecoder(resp.Body).Decode(&pastes); err != nil {
-			return ErrMsg(fmt.Errorf("failed to decode response: %w", err))
+		if err := fn(page.Pastes); err != nil {
+			return err
+		}
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return nil
 		}
+		cursor = page.NextCursor
+	}
+}
 
-		titles := make([]string, len(pastes))
-		for i := range pastes {
-			plain, err := crypt.DecryptPaste(pastes[i].ID, pastes[i].Ciphertext)
-			if err != nil {
-				titles[i] = "Error decrypting"
-				continue
-			}
+func fetchPastesPage(ctx context.Context, publicKey, cursor string, limit int) (PastePage, error) {
+	query := url.Values{"public_key": {publicKey}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
 
-			var data struct {
-				Title string `json:"title"`
-			}
-			if err := json.Unmarshal([]byte(plain), &data); err != nil {
-				titles[i] = "Invalid JSON"
-				continue
-			}
-			titles[i] = data.Title
-		}
+	resp, err := send(ctx, httpClient, Timeouts.List, retryAll, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/pastes?%s", backendURL, query.Encode()), nil)
+	})
+	if err != nil {
+		return PastePage{}, requestErr("failed to make request", err)
+	}
+	defer resp.Body.Close()
 
-		return PasteListFetchedMsg{
-			List:   pastes,
-			Titles: titles,
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return PastePage{}, fmt.Errorf("get pastes failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return PastePage{}, requestErr("failed to read response", err)
+	}
+
+	// servers without pagination answer with a bare array, the whole list
+	// in one page
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var pastes []Paste
+		if err := json.Unmarshal(trimmed, &pastes); err != nil {
+			return PastePage{}, fmt.Errorf("failed to decode response: %w", err)
 		}
+		return PastePage{Pastes: pastes, Total: len(pastes)}, nil
 	}
+
+	var page PastePage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return PastePage{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return page, nil
 }
 
-func GetPaste(id string) tea.Cmd {
+func GetPaste(ctx context.Context, id string) tea.Cmd {
 	return func() tea.Msg {
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/pastes/%s", backendURL, id), nil)
-		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to create request: %w", err))
-		}
-
-		resp, err := httpClient.Do(req)
+		resp, err := send(ctx, httpClient, Timeouts.Fetch, retryAll, func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/pastes/%s", backendURL, url.PathEscape(id)), nil)
+		})
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to make request: %w", err))
+			return ErrMsg(requestErr("failed to make request", err))
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			if resp.StatusCode == 400 {
-				return ErrMsg(fmt.Errorf("invalid paste ID"))
+				return ErrMsg(ErrInvalidPasteID)
 			} else if resp.StatusCode == 404 {
-				return ErrMsg(fmt.Errorf("Paste not found"))
+				return ErrMsg(ErrPasteNotFound)
 			} else if resp.StatusCode == 410 {
-				return ErrMsg(fmt.Errorf("Paste has expired"))
+				return ErrMsg(ErrPasteExpired)
 			} else {
 				return ErrMsg(fmt.Errorf(("Internal server error")))
 			}
@@ -203,10 +383,22 @@ func GetPaste(id string) tea.Cmd {
 		var paste Paste
 		err = json.NewDecoder(resp.Body).Decode(&paste)
 		if err != nil {
-			return ErrMsg(fmt.Errorf("failed to decode response: %w", err))
+			return ErrMsg(requestErr("failed to decode response", err))
 		}
 		return PasteFetchedMsg{
 			paste,
 		}
 	}
 }
+
+// postJSON sends an unauthenticated JSON body to path
+func postJSON(ctx context.Context, timeout time.Duration, mode retryMode, path string, body []byte) (*http.Response, error) {
+	return send(ctx, httpClient, timeout, mode, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", backendURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
@@ -0,0 +1,338 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/devserver"
+	"Drop-Key-TUI/paste"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type identity struct {
+	id    string
+	pub   string
+	priv  string
+	token string
+	keys  crypt.KeyStore
+}
+
+// setup points the client at a fresh dev server
+func setup(t *testing.T) {
+	t.Helper()
+	ts := httptest.NewServer(devserver.New())
+	t.Cleanup(ts.Close)
+	api.SetBackendURL(ts.URL)
+}
+
+// setupFlaky is setup with fail in front of the dev server, it answers
+// a request itself by returning true. Retries are made quick.
+func setupFlaky(t *testing.T, fail func(w http.ResponseWriter, r *http.Request) bool) *devserver.Server {
+	t.Helper()
+	srv := devserver.New()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fail(w, r) {
+			srv.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	api.SetBackendURL(ts.URL)
+
+	retries := api.Retries
+	api.Retries = api.RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	t.Cleanup(func() { api.Retries = retries })
+	return srv
+}
+
+func run[T any](t *testing.T, cmd tea.Cmd) T {
+	t.Helper()
+	msg := cmd()
+	if err, ok := msg.(api.ErrMsg); ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, ok := msg.(T)
+	if !ok {
+		t.Fatalf("got %T, want %T", msg, out)
+	}
+	return out
+}
+
+func register(t *testing.T) identity {
+	t.Helper()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	who := identity{
+		pub:  base64.StdEncoding.EncodeToString(pub),
+		priv: base64.StdEncoding.EncodeToString(priv),
+		keys: crypt.NewMemoryKeyStore(),
+	}
+	who.id = run[api.RegisterUserResponse](t, api.RegisterUser(t.Context(), who.pub)).ID
+
+	challenge := run[api.ChallengeMsg](t, api.RequestChallenge(t.Context(), who.id))
+	signature := ed25519.Sign(priv, api.ChallengeMessage(who.id, challenge.Nonce))
+	auth := run[api.AuthResponse](t, api.AuthenticateUser(t.Context(), api.AuthRequest{
+		ID:        who.id,
+		PublicKey: who.pub,
+		Challenge: challenge.Nonce,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	}))
+	who.token = auth.Token
+	return who
+}
+
+func (who identity) createPaste(t *testing.T, p *paste.Payload) string {
+	t.Helper()
+	sealed, err := paste.Seal(who.keys, p, paste.Auto, who.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := run[api.PasteCreatedMsg](t, api.CreatePaste(t.Context(), api.PasteRequest{
+		Ciphertext:     sealed.Ciphertext,
+		Signature:      sealed.Signature,
+		PublicKey:      who.pub,
+		ExpiresIn:      86400,
+		TitleHeader:    sealed.TitleHeader,
+		TitleSignature: sealed.TitleSignature,
+	}, who.token, sealed.TempID))
+	if created.TempID != sealed.TempID {
+		t.Fatalf("temp ID %q, want %q", created.TempID, sealed.TempID)
+	}
+	if err := crypt.MoveKey(who.keys, created.TempID, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	return created.ID
+}
+
+func TestPasteRoundTrip(t *testing.T) {
+	setup(t)
+	who := register(t)
+	id := who.createPaste(t, paste.Text("shopping", "milk, eggs"))
+
+	list := run[api.PasteListFetchedMsg](t, api.GetPastes(t.Context(), who.pub))
+	if len(list.List) != 1 || list.List[0].ID != id {
+		t.Fatalf("list = %+v", list)
+	}
+	listed := list.List[0]
+	if crypt.Verify(listed.Ciphertext, listed.Signature, listed.PublicKey, nil) != crypt.Verified {
+		t.Fatal("listed paste does not verify")
+	}
+	if crypt.VerifyTitle(listed.TitleHeader, listed.TitleSignature, listed.PublicKey, nil) != crypt.Verified {
+		t.Fatal("listed title header does not verify")
+	}
+	header, err := paste.OpenTitle(who.keys, id, listed.TitleHeader)
+	if err != nil || header.Title != "shopping" {
+		t.Fatalf("title header = %+v, %v", header, err)
+	}
+
+	fetched := run[api.PasteFetchedMsg](t, api.GetPaste(t.Context(), id))
+	opened, err := crypt.VerifyAndOpen(who.keys, id, fetched.Ciphertext, fetched.Signature, fetched.PublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := paste.Unmarshal(opened.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload.Body) != "milk, eggs" {
+		t.Fatalf("body = %q", payload.Body)
+	}
+}
+
+func TestGetPastesPages(t *testing.T) {
+	setup(t)
+	who := register(t)
+	for range api.PastePageSize + 1 {
+		who.createPaste(t, paste.Text("t", "body"))
+	}
+
+	first := run[api.PastePageFetchedMsg](t, api.GetPastesPage(t.Context(), who.pub, "", api.PastePageSize))
+	if len(first.Pastes) != api.PastePageSize || first.Total != api.PastePageSize+1 || first.NextCursor == "" {
+		t.Fatalf("first page: %d pastes, total %d, cursor %q", len(first.Pastes), first.Total, first.NextCursor)
+	}
+	last := run[api.PastePageFetchedMsg](t, api.GetPastesPage(t.Context(), who.pub, first.NextCursor, api.PastePageSize))
+	if len(last.Pastes) != 1 || last.NextCursor != "" {
+		t.Fatalf("last page: %d pastes, cursor %q", len(last.Pastes), last.NextCursor)
+	}
+
+	all := run[api.PasteListFetchedMsg](t, api.GetPastes(t.Context(), who.pub))
+	if len(all.List) != api.PastePageSize+1 {
+		t.Fatalf("GetPastes returned %d pastes", len(all.List))
+	}
+}
+
+func TestGetPasteErrors(t *testing.T) {
+	setup(t)
+
+	tests := map[string]string{
+		"not-a-uuid":                           "invalid paste ID",
+		"5f0c6a4e-3c1e-4d36-9c43-0c1f1f6f3c11": "Paste not found",
+	}
+	for id, want := range tests {
+		msg := api.GetPaste(t.Context(), id)()
+		err, ok := msg.(api.ErrMsg)
+		if !ok || err.Error() != want {
+			t.Errorf("GetPaste(%q) = %v, want %q", id, msg, want)
+		}
+	}
+}
+
+func TestCreatePasteWithStaleToken(t *testing.T) {
+	setup(t)
+	who := register(t)
+
+	sealed, err := paste.Seal(who.keys, paste.Text("t", "body"), paste.None, who.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := api.PasteRequest{Ciphertext: sealed.Ciphertext, Signature: sealed.Signature, PublicKey: who.pub, ExpiresIn: 3600, TitleHeader: sealed.TitleHeader, TitleSignature: sealed.TitleSignature}
+
+	unauthorized := run[api.UnauthorizedMsg](t, api.CreatePaste(t.Context(), req, "stale", sealed.TempID))
+	created := run[api.PasteCreatedMsg](t, unauthorized.Retry(who.token))
+	if created.ID == "" {
+		t.Fatal("retry did not create the paste")
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	setup(t)
+	who := register(t)
+
+	body := bytes.Repeat([]byte("streamed line\n"), 20000)
+	sealed, err := paste.SealStream(who.keys, &paste.Payload{Title: "big", MIME: paste.TextMIME, Size: int64(len(body))}, bytes.NewReader(body), paste.Auto, who.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := run[api.PasteCreatedMsg](t, api.UploadPasteStream(t.Context(), api.StreamUpload{
+		PublicKey: who.pub,
+		ExpiresIn: 3600,
+		Body:      sealed,
+		Signature: sealed.Signature,
+	}, who.token, sealed.TempID))
+	if err := crypt.MoveKey(who.keys, created.TempID, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	download := run[api.PasteStreamMsg](t, api.DownloadPasteStream(t.Context(), created.ID))
+	defer download.Body.Close()
+	opened, err := paste.OpenStream(who.keys, created.ID, download.Body, download.Signature, download.PublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+	if opened.Status != crypt.Verified {
+		t.Fatalf("status = %v", opened.Status)
+	}
+	got, err := io.ReadAll(opened.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("body differs: %d bytes, want %d", len(got), len(body))
+	}
+}
+
+func TestAuthenticateRejectsWrongKey(t *testing.T) {
+	setup(t)
+	who := register(t)
+
+	_, other, _ := ed25519.GenerateKey(nil)
+	challenge := run[api.ChallengeMsg](t, api.RequestChallenge(t.Context(), who.id))
+	msg := api.AuthenticateUser(t.Context(), api.AuthRequest{
+		ID:        who.id,
+		PublicKey: who.pub,
+		Challenge: challenge.Nonce,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(other, api.ChallengeMessage(who.id, challenge.Nonce))),
+	})()
+
+	err, ok := msg.(api.ErrMsg)
+	if !ok || !errors.Is(err, api.ErrBadSignature) {
+		t.Fatalf("got %v, want ErrBadSignature", msg)
+	}
+	if !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("error %q does not mention the signature", err)
+	}
+}
+
+func TestRetryAfterBusy(t *testing.T) {
+	var busy atomic.Int32
+	setupFlaky(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "GET" && busy.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	})
+	who := register(t)
+	id := who.createPaste(t, paste.Text("t", "body"))
+
+	var events []api.RetryEvent
+	ctx := api.WithRetryHook(t.Context(), func(e api.RetryEvent) { events = append(events, e) })
+	run[api.PasteFetchedMsg](t, api.GetPaste(ctx, id))
+	if len(events) != 2 || events[1].Attempt != 3 || !errors.Is(events[1].Err, api.ErrServerBusy) {
+		t.Fatalf("retry events = %+v", events)
+	}
+
+	busy.Store(-10)
+	msg := api.GetPaste(t.Context(), id)()
+	if err, ok := msg.(api.ErrMsg); !ok || !errors.Is(err, api.ErrServerBusy) {
+		t.Fatalf("got %v, want ErrServerBusy once the attempts run out", msg)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	var calls atomic.Int32
+	setupFlaky(t, func(w http.ResponseWriter, r *http.Request) bool {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	})
+
+	msg := api.GetPaste(t.Context(), "5f0c6a4e-3c1e-4d36-9c43-0c1f1f6f3c11")()
+	if err, ok := msg.(api.ErrMsg); !ok || !errors.Is(err, api.ErrServerBusy) {
+		t.Fatalf("got %v, want ErrServerBusy", msg)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("server was asked %d times", calls.Load())
+	}
+}
+
+func TestCreatePasteNotRetriedAfterLostAnswer(t *testing.T) {
+	var lost atomic.Bool
+	var srv *devserver.Server
+	srv = setupFlaky(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != "POST" || r.URL.Path != "/api/pastes" || lost.Swap(true) {
+			return false
+		}
+		// the paste is stored but the answer never makes it back
+		srv.ServeHTTP(httptest.NewRecorder(), r)
+		w.WriteHeader(http.StatusBadGateway)
+		return true
+	})
+	who := register(t)
+
+	sealed, err := paste.Seal(who.keys, paste.Text("t", "body"), paste.None, who.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := api.PasteRequest{Ciphertext: sealed.Ciphertext, Signature: sealed.Signature, PublicKey: who.pub, ExpiresIn: 3600, TitleHeader: sealed.TitleHeader, TitleSignature: sealed.TitleSignature}
+	msg := api.CreatePaste(t.Context(), req, who.token, sealed.TempID)()
+	if failed, ok := msg.(api.PasteCreateFailedMsg); !ok || failed.TempID != sealed.TempID || failed.Rejected {
+		t.Fatalf("got %T, want the 502 reported without a rejection", msg)
+	}
+	if n := srv.PasteCount(); n != 1 {
+		t.Fatalf("%d pastes stored, want 1", n)
+	}
+}
@@ -4,6 +4,7 @@ import "time"
 
 type ErrorResponse struct {
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
 }
 
 type RegisterUserRequest struct {
@@ -19,6 +20,15 @@ type User struct {
 	PublicKey string `json:"public_key"`
 }
 
+type ChallengeRequest struct {
+	ID string `json:"id"`
+}
+
+type ChallengeResponse struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type AuthRequest struct {
 	ID        string `json:"id"`
 	Signature string `json:"signature"`
@@ -27,8 +37,9 @@ type AuthRequest struct {
 }
 
 type AuthResponse struct {
-	Message string `json:"message"`
-	Token   string `json:"token"`
+	Message   string    `json:"message"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
 }
 
 type Paste struct {
@@ -37,16 +48,43 @@ type Paste struct {
 	Signature  string    `json:"signature"`
 	PublicKey  string    `json:"public_key"`
 	ExpiresAt  time.Time `json:"expires_at"`
+	// Streamed pastes have no inline ciphertext, it is downloaded from
+	// /api/pastes/{id}/raw instead
+	Streamed bool `json:"streamed,omitempty"`
+	// TitleHeader is the separately sealed title, see paste.SealTitle.
+	// Pastes from older clients do not have one. TitleSignature is the
+	// signer's signature over it.
+	TitleHeader    string `json:"title_header,omitempty"`
+	TitleSignature string `json:"title_signature,omitempty"`
+}
+
+// PastePage is one page of GET /api/pastes, newest first. NextCursor is
+// empty on the last page and Total counts every live paste of the key.
+type PastePage struct {
+	Pastes     []Paste `json:"pastes"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      int     `json:"total"`
 }
 
 type PasteRequest struct {
-	Ciphertext string `json:"ciphertext"`
-	Signature  string `json:"signature"`
-	PublicKey  string `json:"public_key"`
-	ExpiresIn  int    `json:"expires_in"`
+	Ciphertext     string `json:"ciphertext"`
+	Signature      string `json:"signature"`
+	PublicKey      string `json:"public_key"`
+	ExpiresIn      int    `json:"expires_in"`
+	TitleHeader    string `json:"title_header,omitempty"`
+	TitleSignature string `json:"title_signature,omitempty"`
 }
 
 type CreatePasteResponse struct {
 	ID  string `json:"id"`
 	URL string `json:"url"`
 }
+
+type KeyRotation struct {
+	UserID          string    `json:"user_id"`
+	OldPublicKey    string    `json:"old_public_key"`
+	NewPublicKey    string    `json:"new_public_key"`
+	RotatedAt       time.Time `json:"rotated_at"`
+	Signature       string    `json:"signature"`
+	NewKeySignature string    `json:"new_key_signature"`
+}
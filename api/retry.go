@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrServerBusy is wrapped when the server keeps answering 429 or 503, or
+// asks to be left alone for longer than Retries.MaxDelay.
+var ErrServerBusy = errors.New("server is busy, please try again later")
+
+// RetryPolicy says how requests that failed on the way are retried.
+// Backoff starts at BaseDelay and doubles on every attempt up to MaxDelay,
+// each wait is jittered between half and all of it. A Retry-After from the
+// server is waited out as given, unless it is longer than MaxDelay.
+type RetryPolicy struct {
+	// Attempts counts the first request too, 1 turns retrying off
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Retries applies to every request sent through send.
+var Retries = RetryPolicy{
+	Attempts:  4,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  10 * time.Second,
+}
+
+// backoff is the jittered wait before the given attempt, from 2
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 2)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// RetryEvent is reported before a request is sent again.
+type RetryEvent struct {
+	// Attempt is the one about to be made, out of Attempts
+	Attempt  int
+	Attempts int
+	Wait     time.Duration
+	// Err is why the previous attempt failed
+	Err error
+}
+
+type retryHookKey struct{}
+
+// WithRetryHook returns a context whose requests call hook before every
+// retry, e.g. to show it on a spinner. hook runs on the request's
+// goroutine.
+func WithRetryHook(ctx context.Context, hook func(RetryEvent)) context.Context {
+	return context.WithValue(ctx, retryHookKey{}, hook)
+}
+
+// retryMode says which failures a request may be sent again after
+type retryMode int
+
+const (
+	// noRetry is for bodies that cannot be replayed
+	noRetry retryMode = iota
+	// retryBusy only retries a 429 or a 503, the server turned the
+	// request away before acting on it. For requests that must not run
+	// twice, such as answering a single-use challenge or a create.
+	retryBusy
+	// retryAll also retries network errors, a 502 and a 504, after which
+	// the server may have acted on the request. For reads, and requests
+	// that are harmless to repeat such as asking for a challenge.
+	retryAll
+)
+
+// send sends the request newReq builds, once per attempt so its body is
+// fresh, on client. Each attempt is bounded by timeout and the response
+// body releases it when closed. Once the attempts run out on a 429 or a
+// 503, ErrServerBusy is returned instead of the response.
+func send(ctx context.Context, client *http.Client, timeout time.Duration, mode retryMode, newReq func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	attempts := Retries.Attempts
+	if mode == noRetry || attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := sendOnce(ctx, client, timeout, newReq)
+
+		var wait time.Duration
+		var cause error
+		switch {
+		case err != nil:
+			if mode != retryAll || ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+				return nil, err
+			}
+			cause = err
+		case busy(resp.StatusCode):
+			cause = fmt.Errorf("%w (status %d)", ErrServerBusy, resp.StatusCode)
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if after > Retries.MaxDelay {
+					drain(resp)
+					return nil, fmt.Errorf("%w, it asked to retry in %s", ErrServerBusy, after.Round(time.Second))
+				}
+				wait = after
+			}
+		case mode == retryAll && (resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout):
+			cause = fmt.Errorf("server answered %d", resp.StatusCode)
+		default:
+			return resp, nil
+		}
+
+		if attempt >= attempts {
+			if err != nil {
+				return nil, err
+			}
+			if busy(resp.StatusCode) {
+				drain(resp)
+				return nil, cause
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			drain(resp)
+		}
+
+		if wait == 0 {
+			wait = Retries.backoff(attempt + 1)
+		}
+		if hook, ok := ctx.Value(retryHookKey{}).(func(RetryEvent)); ok {
+			hook(RetryEvent{Attempt: attempt + 1, Attempts: attempts, Wait: wait, Err: cause})
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func sendOnce(ctx context.Context, client *http.Client, timeout time.Duration, newReq func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	req, err := newReq(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// busy reports whether the server turned the request away, 429 and 503
+// say nothing was done
+func busy(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter reads a Retry-After header, either seconds or an HTTP date
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// drain reads a little of a discarded response so the connection can be
+// reused
+func drain(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, 4096)
+	resp.Body.Close()
+}
+
+// cancelOnClose releases the context of an attempt with its body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
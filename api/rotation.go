@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"Drop-Key-TUI/crypt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type KeyRotatedMsg struct {
+	KeyRotation
+}
+
+type KeyHistoryFetchedMsg struct {
+	PublicKey string
+	Rotations []KeyRotation
+}
+
+// Statement returns the signed part of a rotation record.
+func (r KeyRotation) Statement() crypt.RotationStatement {
+	return crypt.RotationStatement{
+		UserID:       r.UserID,
+		OldPublicKey: r.OldPublicKey,
+		NewPublicKey: r.NewPublicKey,
+		RotatedAt:    r.RotatedAt,
+	}
+}
+
+// Valid reports whether both keys signed the rotation statement.
+func (r KeyRotation) Valid() bool {
+	return r.Statement().Verify(r.Signature, r.NewKeySignature)
+}
+
+// RotateKey records a key rotation endorsed by the old key.
+func RotateKey(ctx context.Context, rotation KeyRotation, token string) tea.Cmd {
+	return func() tea.Msg {
+		jsonBody, err := json.Marshal(rotation)
+		if err != nil {
+			return ErrMsg(fmt.Errorf("failed to marshal request: %w", err))
+		}
+
+		resp, err := send(ctx, httpClient, Timeouts.Auth, retryBusy, func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/users/rotate", backendURL), bytes.NewReader(jsonBody))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		})
+		if err != nil {
+			return ErrMsg(requestErr("failed to make rotate key request", err))
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			return UnauthorizedMsg{
+				Retry: func(token string) tea.Cmd {
+					return RotateKey(ctx, rotation, token)
+				},
+			}
+		}
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			return ErrMsg(fmt.Errorf("rotate key request failed with status %d: %s", resp.StatusCode, string(bodyBytes)))
+		}
+
+		return KeyRotatedMsg{rotation}
+	}
+}
+
+// GetKeyHistory fetches every rotation of the account owning publicKey,
+// oldest first. Records whose signatures do not check out are dropped.
+func GetKeyHistory(ctx context.Context, publicKey string) tea.Cmd {
+	return func() tea.Msg {
+		resp, err := send(ctx, httpClient, Timeouts.Fetch, retryAll, func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/users/keys?public_key=%s", backendURL, url.QueryEscape(publicKey)), nil)
+		})
+		if err != nil {
+			return ErrMsg(requestErr("failed to make request", err))
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return KeyHistoryFetchedMsg{PublicKey: publicKey}
+		}
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			return ErrMsg(fmt.Errorf("get key history failed with status %d: %s", resp.StatusCode, string(bodyBytes)))
+		}
+
+		var rotations []KeyRotation
+		if err := json.NewDecoder(resp.Body).Decode(&rotations); err != nil {
+			return ErrMsg(fmt.Errorf("failed to decode response: %w", err))
+		}
+
+		valid := rotations[:0]
+		for _, r := range rotations {
+			if r.Valid() {
+				valid = append(valid, r)
+			}
+		}
+
+		return KeyHistoryFetchedMsg{
+			PublicKey: publicKey,
+			Rotations: valid,
+		}
+	}
+}
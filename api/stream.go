@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// streamClient has no overall timeout since uploads and downloads of large
+// pastes take as long as they take, only the wait for response headers is
+// bounded.
+var streamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// StreamUpload describes a streamed paste. Body is read to EOF before
+// Signature is called, so the signature can cover the whole ciphertext.
+type StreamUpload struct {
+	PublicKey      string
+	ExpiresIn      int
+	TitleHeader    string
+	TitleSignature string
+	Body           io.Reader
+	Signature      func() (string, error)
+}
+
+// PasteStreamMsg carries an open download of a streamed paste. The
+// caller must close Body.
+type PasteStreamMsg struct {
+	ID        string
+	Signature string
+	PublicKey string
+	Body      io.ReadCloser
+}
+
+// UploadPasteStream sends a streamed paste as a multipart form. The parts
+// are written as the body is read: public_key, expires_in, title_header,
+// title_signature, the ciphertext file and finally the signature.
+//
+// The body cannot be replayed, so a 401 is reported as ErrUnauthorized
+// rather than an UnauthorizedMsg and nothing is retried; callers should
+// make sure the token is fresh first. tempID is still sent as the
+// idempotency key, as CreatePaste does.
+func UploadPasteStream(ctx context.Context, upload StreamUpload, token, tempID string) tea.Cmd {
+	return func() tea.Msg {
+		pr, pw := io.Pipe()
+		form := multipart.NewWriter(pw)
+		go func() {
+			pw.CloseWithError(writeStreamForm(form, upload))
+		}()
+
+		req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/pastes/stream", backendURL), pr)
+		if err != nil {
+			pr.Close()
+			return createRejected(tempID, fmt.Errorf("failed to generate stream upload request"))
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Idempotency-Key", tempID)
+
+		resp, err := streamClient.Do(req)
+		if err != nil {
+			return createFailed(tempID, requestErr("failed to upload paste", err))
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			return createRejected(tempID, ErrUnauthorized)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			err := fmt.Errorf("stream upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+			if isRejection(resp.StatusCode) {
+				return createRejected(tempID, err)
+			}
+			return createFailed(tempID, err)
+		}
+
+		var pasteResponse CreatePasteResponse
+		if err := json.NewDecoder(resp.Body).Decode(&pasteResponse); err != nil {
+			return createFailed(tempID, fmt.Errorf("failed to decode create paste response: %w", err))
+		}
+		return PasteCreatedMsg{
+			TempID:              tempID,
+			CreatePasteResponse: pasteResponse,
+		}
+	}
+}
+
+func writeStreamForm(form *multipart.Writer, upload StreamUpload) error {
+	if err := form.WriteField("public_key", upload.PublicKey); err != nil {
+		return err
+	}
+	if err := form.WriteField("expires_in", strconv.Itoa(upload.ExpiresIn)); err != nil {
+		return err
+	}
+	if upload.TitleHeader != "" {
+		if err := form.WriteField("title_header", upload.TitleHeader); err != nil {
+			return err
+		}
+		if err := form.WriteField("title_signature", upload.TitleSignature); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("ciphertext", "paste.bin")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, upload.Body); err != nil {
+		return err
+	}
+
+	signature, err := upload.Signature()
+	if err != nil {
+		return err
+	}
+	if err := form.WriteField("signature", signature); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// DownloadPasteStream opens the raw ciphertext of a streamed paste. The
+// signature and signer travel in response headers. Cancelling ctx also
+// aborts reading Body.
+func DownloadPasteStream(ctx context.Context, id string) tea.Cmd {
+	return func() tea.Msg {
+		resp, err := send(ctx, streamClient, 0, retryAll, func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/pastes/%s/raw", backendURL, url.PathEscape(id)), nil)
+		})
+		if err != nil {
+			return ErrMsg(requestErr("failed to download paste", err))
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return PasteStreamMsg{
+				ID:        id,
+				Signature: resp.Header.Get("X-Paste-Signature"),
+				PublicKey: resp.Header.Get("X-Paste-Public-Key"),
+				Body:      resp.Body,
+			}
+		case http.StatusNotFound:
+			resp.Body.Close()
+			return ErrMsg(ErrPasteNotFound)
+		case http.StatusGone:
+			resp.Body.Close()
+			return ErrMsg(ErrPasteExpired)
+		}
+
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return ErrMsg(fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(bodyBytes)))
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultTokenLifetime is assumed when neither the auth response nor the
+// token itself says when it expires.
+const defaultTokenLifetime = 15 * time.Minute
+
+// Expiry returns when the token in the response stops being valid. The
+// expires_at field from the server wins, then the JWT exp claim, and as a
+// last resort a conservative default lifetime.
+func (r AuthResponse) Expiry() time.Time {
+	if !r.ExpiresAt.IsZero() {
+		return r.ExpiresAt
+	}
+	if exp, err := TokenExpiry(r.Token); err == nil {
+		return exp
+	}
+	return time.Now().Add(defaultTokenLifetime)
+}
+
+// TokenExpiry reads the exp claim out of a JWT without verifying it. The
+// server is the one verifying tokens, the client only needs to know when
+// to stop reusing one.
+func TokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode token claims: %w", err)
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse token claims: %w", err)
+	}
+	if claims.Exp == "" {
+		return time.Time{}, errors.New("token has no exp claim")
+	}
+
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid exp claim: %w", err)
+	}
+	return time.Unix(int64(exp), 0), nil
+}
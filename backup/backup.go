@@ -0,0 +1,455 @@
+// Package backup packs the identity key pair, user ID and every per-paste
+// key into one passphrase-encrypted archive, and merges such an archive
+// back into an install.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	magic         = "DKBACKUP"
+	formatVersion = 1
+
+	// scrypt cost, recorded in the header as log2(N) so it can be raised
+	// later without breaking old archives
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	saltSize  = 16
+	nonceSize = 12
+	keySize   = 32
+
+	// maxArchiveSize bounds how much a restore will decompress, an
+	// install with tens of thousands of keys is still far below it
+	maxArchiveSize = 64 << 20
+
+	manifestName = "manifest.json"
+	identityName = "identity.json"
+	keysDir      = "keys/"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted backup")
+	ErrNotABackup      = errors.New("not a DropKey backup file")
+)
+
+// Manifest lists every file in the archive with its SHA-256, so a restore
+// can tell a complete archive from a tampered or truncated one.
+type Manifest struct {
+	Version     int             `json:"version"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UserID      string          `json:"user_id,omitempty"`
+	Fingerprint string          `json:"fingerprint"`
+	Files       []ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Report describes what a restore changed.
+type Report struct {
+	IdentityRestored bool
+	// IdentityConflict is set when the archive holds a different identity
+	// than the one already configured, which is left untouched.
+	IdentityConflict bool
+	// RetiredKeysRestored counts the retired identity keys of the same
+	// identity that only the archive knew about.
+	RetiredKeysRestored int
+	UserIDRestored      bool
+	KeysRestored        int
+	KeysUnchanged       int
+	// KeysConflicting lists paste IDs whose local key differs from the
+	// archived one. The local key is kept.
+	KeysConflicting []string
+}
+
+// String describes the restore in a few lines.
+func (r *Report) String() string {
+	var b strings.Builder
+	switch {
+	case r.IdentityRestored:
+		b.WriteString("Identity restored.\n")
+	case r.IdentityConflict:
+		b.WriteString("A different identity is already configured, it was kept.\n")
+	default:
+		b.WriteString("Identity already present.\n")
+	}
+	if r.RetiredKeysRestored > 0 {
+		fmt.Fprintf(&b, "%d retired identity keys restored.\n", r.RetiredKeysRestored)
+	}
+	if r.UserIDRestored {
+		b.WriteString("User ID restored.\n")
+	}
+	fmt.Fprintf(&b, "%d paste keys restored, %d already present.\n", r.KeysRestored, r.KeysUnchanged)
+	if len(r.KeysConflicting) > 0 {
+		fmt.Fprintf(&b, "%d paste keys differ from the local copy and were kept as they are:\n", len(r.KeysConflicting))
+		for _, id := range r.KeysConflicting {
+			b.WriteString("  " + id + "\n")
+		}
+	}
+	return b.String()
+}
+
+// Export writes an encrypted archive of the identity in store and every
+// paste key in keys to w.
+func Export(store config.Store, keys crypt.KeyStore, w io.Writer, passphrase []byte) (*Manifest, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+
+	cfg, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	identity, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal identity: %w", err)
+	}
+
+	files := map[string][]byte{identityName: identity}
+
+	ids, err := keys.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paste keys: %w", err)
+	}
+	for _, id := range ids {
+		key, err := keys.GetKey(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", id, err)
+		}
+		files[keysDir+id+".key"] = key
+	}
+
+	manifest := &Manifest{
+		Version:     formatVersion,
+		CreatedAt:   time.Now().UTC(),
+		Fingerprint: crypt.Fingerprint(cfg.PublicKey),
+	}
+	if userID, err := store.LoadUserID(); err == nil {
+		manifest.UserID = userID
+	}
+
+	archive, err := pack(manifest, files)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := seal(w, archive, passphrase); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Import decrypts an archive and merges it into store and keys.
+// Nothing that already exists is overwritten: a different identity or a
+// different key for the same paste is reported and the local copy kept.
+func Import(store config.Store, keys crypt.KeyStore, r io.Reader, passphrase []byte) (*Report, error) {
+	archive, err := open(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, files, err := unpack(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+
+	var archived config.Config
+	if err := json.Unmarshal(files[identityName], &archived); err != nil {
+		return nil, fmt.Errorf("failed to decode archived identity: %w", err)
+	}
+	current, err := store.Load()
+	switch {
+	case err != nil:
+		if err := store.Save(&archived); err != nil {
+			return nil, err
+		}
+		report.IdentityRestored = true
+	case current.PublicKey != archived.PublicKey:
+		report.IdentityConflict = true
+	default:
+		// an identity rebuilt from its recovery phrase has no retired keys,
+		// the archive may still know them
+		if n := mergeRetiredKeys(current, archived.PreviousKeys); n > 0 {
+			if err := store.Save(current); err != nil {
+				return nil, err
+			}
+			report.RetiredKeysRestored = n
+		}
+	}
+
+	if manifest.UserID != "" && !report.IdentityConflict {
+		if _, err := store.LoadUserID(); err != nil {
+			if err := store.SaveUserID(manifest.UserID); err != nil {
+				return nil, err
+			}
+			report.UserIDRestored = true
+		}
+	}
+
+	for name, key := range files {
+		if !strings.HasPrefix(name, keysDir) {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(name, keysDir), ".key")
+
+		existing, err := keys.GetKey(id)
+		if err == nil {
+			if bytes.Equal(existing, key) {
+				report.KeysUnchanged++
+			} else {
+				report.KeysConflicting = append(report.KeysConflicting, id)
+			}
+			continue
+		}
+
+		if err := keys.SaveKey(id, key); err != nil {
+			return nil, fmt.Errorf("failed to restore key %s: %w", id, err)
+		}
+		report.KeysRestored++
+	}
+
+	return report, nil
+}
+
+// mergeRetiredKeys adds the retired keys cfg does not have yet, keeping
+// them oldest first, and returns how many were added.
+func mergeRetiredKeys(cfg *config.Config, retired []config.RetiredKey) int {
+	added := 0
+	for _, k := range retired {
+		if k.PublicKey == "" || cfg.OwnsKey(k.PublicKey) {
+			continue
+		}
+		cfg.PreviousKeys = append(cfg.PreviousKeys, k)
+		added++
+	}
+	if added > 0 {
+		sort.SliceStable(cfg.PreviousKeys, func(i, j int) bool {
+			return cfg.PreviousKeys[i].RetiredAt.Before(cfg.PreviousKeys[j].RetiredAt)
+		})
+	}
+	return added
+}
+
+// pack builds a gzipped tar with the manifest first and every file after.
+func pack(manifest *Manifest, files map[string][]byte) ([]byte, error) {
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Name:   name,
+			Size:   len(data),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	write := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0o600,
+			Size:    int64(len(data)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := write(manifestName, manifestJSON); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	for _, entry := range manifest.Files {
+		if err := write(entry.Name, files[entry.Name]); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpack reads the archive and checks every file against the manifest.
+func unpack(archive []byte) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	tr := tar.NewReader(io.LimitReader(gz, maxArchiveSize))
+
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Clean(hdr.Name) != hdr.Name || strings.Contains(hdr.Name, "..") {
+			return nil, nil, fmt.Errorf("unexpected entry %q in archive", hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		files[hdr.Name] = data
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(files[manifestName], &manifest); err != nil {
+		return nil, nil, fmt.Errorf("archive has no valid manifest: %w", err)
+	}
+	if manifest.Version != formatVersion {
+		return nil, nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	delete(files, manifestName)
+
+	if len(manifest.Files) != len(files) {
+		return nil, nil, errors.New("archive contents do not match its manifest")
+	}
+	for _, entry := range manifest.Files {
+		data, ok := files[entry.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("archive is missing %s", entry.Name)
+		}
+		if entry.Name != identityName && !validKeyEntry(entry.Name) {
+			return nil, nil, fmt.Errorf("unexpected entry %q in archive", entry.Name)
+		}
+		sum := sha256.Sum256(data)
+		if len(data) != entry.Size || hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, nil, fmt.Errorf("checksum mismatch for %s", entry.Name)
+		}
+	}
+	if _, ok := files[identityName]; !ok {
+		return nil, nil, errors.New("archive has no identity")
+	}
+
+	return &manifest, files, nil
+}
+
+func validKeyEntry(name string) bool {
+	id, ok := strings.CutPrefix(name, keysDir)
+	if !ok || !strings.HasSuffix(id, ".key") {
+		return false
+	}
+	id = strings.TrimSuffix(id, ".key")
+	return id != "" && !strings.ContainsAny(id, `/\`)
+}
+
+// seal writes header || AES-GCM(archive), with the header as associated
+// data so the KDF parameters cannot be swapped.
+func seal(w io.Writer, archive, passphrase []byte) error {
+	header := make([]byte, 0, len(magic)+2+saltSize+nonceSize)
+	header = append(header, magic...)
+	header = append(header, formatVersion, scryptLogN)
+
+	salt := make([]byte, saltSize)
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	gcm, err := newGCM(passphrase, salt, scryptLogN)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(gcm.Seal(nil, nonce, archive, header))
+	return err
+}
+
+func open(r io.Reader, passphrase []byte) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveSize))
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := len(magic) + 2 + saltSize + nonceSize
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, ErrNotABackup
+	}
+	if data[len(magic)] != formatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", data[len(magic)])
+	}
+
+	logN := data[len(magic)+1]
+	salt := data[len(magic)+2 : len(magic)+2+saltSize]
+	nonce := data[len(magic)+2+saltSize : headerSize]
+
+	gcm, err := newGCM(passphrase, salt, logN)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := gcm.Open(nil, nonce, data[headerSize:], data[:headerSize])
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return archive, nil
+}
+
+func newGCM(passphrase, salt []byte, logN byte) (cipher.AEAD, error) {
+	if logN < 10 || logN > 22 {
+		return nil, fmt.Errorf("unsupported key derivation cost %d", logN)
+	}
+	key, err := scrypt.Key(passphrase, salt, 1<<logN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,276 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+)
+
+var passphrase = []byte("correct horse battery staple")
+
+func newIdentity(t *testing.T) *config.Config {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &config.Config{
+		PublicKey:  base64.StdEncoding.EncodeToString(pub),
+		PrivateKey: base64.StdEncoding.EncodeToString(priv),
+	}
+}
+
+// newInstall sets up an identity that rotated once, a user ID and two
+// paste keys, and exports it
+func newInstall(t *testing.T) (*config.Config, *crypt.MemoryKeyStore, []byte) {
+	t.Helper()
+	cfg := newIdentity(t)
+	next := newIdentity(t)
+	cfg.Rotate(next.PublicKey, next.PrivateKey, "endorsement", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+
+	store := config.NewMemoryStore()
+	if err := store.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	store.SaveUserID("user-1")
+
+	keys := crypt.NewMemoryKeyStore()
+	keys.SaveKey("paste-a", bytes.Repeat([]byte{1}, 32))
+	keys.SaveKey("paste-b", bytes.Repeat([]byte{2}, 32))
+
+	var buf bytes.Buffer
+	manifest, err := Export(store, keys, &buf, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 3 {
+		t.Fatalf("manifest lists %d files, want 3", len(manifest.Files))
+	}
+	return cfg, keys, buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	cfg, keys, data := newInstall(t)
+
+	store := config.NewMemoryStore()
+	restored := crypt.NewMemoryKeyStore()
+	report, err := Import(store, restored, bytes.NewReader(data), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.IdentityRestored || !report.UserIDRestored || report.KeysRestored != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cfg) {
+		t.Errorf("identity = %+v, want %+v", got, cfg)
+	}
+	if id, _ := store.LoadUserID(); id != "user-1" {
+		t.Errorf("user ID = %q", id)
+	}
+	for _, id := range []string{"paste-a", "paste-b"} {
+		want, _ := keys.GetKey(id)
+		if key, err := restored.GetKey(id); err != nil || !bytes.Equal(key, want) {
+			t.Errorf("key %s = %x, %v", id, key, err)
+		}
+	}
+
+	// restoring again changes nothing
+	report, err = Import(store, restored, bytes.NewReader(data), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.IdentityRestored || report.KeysRestored != 0 || report.KeysUnchanged != 2 {
+		t.Fatalf("second restore report = %+v", report)
+	}
+}
+
+func TestRetiredKeysAreMerged(t *testing.T) {
+	cfg, _, data := newInstall(t)
+
+	// the same identity rebuilt from its recovery phrase
+	store := config.NewMemoryStore()
+	store.Save(&config.Config{PublicKey: cfg.PublicKey, PrivateKey: cfg.PrivateKey})
+
+	report, err := Import(store, crypt.NewMemoryKeyStore(), bytes.NewReader(data), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.IdentityRestored || report.IdentityConflict || report.RetiredKeysRestored != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	got, _ := store.Load()
+	if !reflect.DeepEqual(got.PreviousKeys, cfg.PreviousKeys) {
+		t.Errorf("retired keys = %+v, want %+v", got.PreviousKeys, cfg.PreviousKeys)
+	}
+
+	// another identity is left alone
+	other := newIdentity(t)
+	store = config.NewMemoryStore()
+	store.Save(other)
+	report, err = Import(store, crypt.NewMemoryKeyStore(), bytes.NewReader(data), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.IdentityConflict || report.RetiredKeysRestored != 0 || report.UserIDRestored {
+		t.Fatalf("conflict report = %+v", report)
+	}
+	if got, _ := store.Load(); !reflect.DeepEqual(got, other) {
+		t.Errorf("identity = %+v, want it kept", got)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	_, _, data := newInstall(t)
+
+	store := config.NewMemoryStore()
+	keys := crypt.NewMemoryKeyStore()
+	if _, err := Import(store, keys, bytes.NewReader(data), []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("err = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Error("identity restored with the wrong passphrase")
+	}
+	if ids, _ := keys.ListKeys(); len(ids) != 0 {
+		t.Errorf("%d keys restored with the wrong passphrase", len(ids))
+	}
+
+	data[len(data)-1] ^= 1
+	if _, err := Import(store, keys, bytes.NewReader(data), passphrase); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("flipped byte: err = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestTamperedManifest(t *testing.T) {
+	_, _, data := newInstall(t)
+	archive, err := open(bytes.NewReader(data), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]func(m *Manifest, files map[string][]byte){
+		"checksum": func(m *Manifest, files map[string][]byte) {
+			m.Files[0].SHA256 = m.Files[1].SHA256
+		},
+		"size": func(m *Manifest, files map[string][]byte) {
+			m.Files[0].Size++
+		},
+		"key swapped": func(m *Manifest, files map[string][]byte) {
+			files[keysDir+"paste-a.key"] = bytes.Repeat([]byte{9}, 32)
+		},
+		"entry dropped": func(m *Manifest, files map[string][]byte) {
+			m.Files = m.Files[1:]
+		},
+		"entry added": func(m *Manifest, files map[string][]byte) {
+			files[keysDir+"paste-c.key"] = bytes.Repeat([]byte{3}, 32)
+		},
+		"path outside keys": func(m *Manifest, files map[string][]byte) {
+			for i, e := range m.Files {
+				if e.Name == keysDir+"paste-a.key" {
+					m.Files[i].Name = "paste-a.key"
+					files["paste-a.key"] = files[e.Name]
+					delete(files, e.Name)
+				}
+			}
+		},
+		"version": func(m *Manifest, files map[string][]byte) {
+			m.Version = formatVersion + 1
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := seal(&buf, repack(t, archive, tamper), passphrase); err != nil {
+				t.Fatal(err)
+			}
+			store := config.NewMemoryStore()
+			keys := crypt.NewMemoryKeyStore()
+			if _, err := Import(store, keys, &buf, passphrase); err == nil {
+				t.Fatal("tampered archive was restored")
+			}
+			if _, err := store.Load(); err == nil {
+				t.Error("identity restored from a tampered archive")
+			}
+			if ids, _ := keys.ListKeys(); len(ids) != 0 {
+				t.Errorf("%d keys restored from a tampered archive", len(ids))
+			}
+		})
+	}
+}
+
+// repack unpacks archive without checking it, lets tamper change the
+// manifest and files, and packs them again as written
+func repack(t *testing.T, archive []byte, tamper func(*Manifest, map[string][]byte)) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string][]byte{}
+	var order []string
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = data
+		order = append(order, hdr.Name)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(files[manifestName], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	delete(files, manifestName)
+	tamper(&manifest, files)
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[manifestName] = manifestJSON
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	write := func(name string) {
+		data, ok := files[name]
+		if !ok {
+			return
+		}
+		delete(files, name)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data))})
+		tw.Write(data)
+	}
+	for _, name := range order {
+		write(name)
+	}
+	for name := range files {
+		write(name)
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"Drop-Key-TUI/backup"
+)
+
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	force := flags.Bool("force", false, "overwrite the output file if it exists")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: dropkey backup [-force] <file>")
+	}
+
+	passphrase, err := readPassphrase("Backup passphrase: ")
+	if err != nil {
+		return err
+	}
+	confirm, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return errors.New("passphrases do not match")
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(flags.Arg(0), mode, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, err := backup.Export(cfgStore, keyStore, f, passphrase)
+	if err != nil {
+		os.Remove(flags.Arg(0))
+		return err
+	}
+	fmt.Printf("Backed up identity %s and %d paste keys to %s\n",
+		manifest.Fingerprint, len(manifest.Files)-1, flags.Arg(0))
+	return nil
+}
+
+func runRestore(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: dropkey restore <file>")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	passphrase, err := readPassphrase("Backup passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	report, err := backup.Import(cfgStore, keyStore, f, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package cli implements the dropkey subcommands that run without the TUI.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(args []string) error
+}
+
+var commands []command
+
+// the subcommands read and write the same files as the TUI
+var (
+	cfgStore config.Store   = config.FSStore{}
+	keyStore crypt.KeyStore = crypt.FSKeyStore{}
+)
+
+func init() {
+	commands = []command{
+		{name: "import", usage: "import [-force] [-register] <key file>", help: "import an identity key", run: runImport},
+		{name: "backup", usage: "backup [-force] <file>", help: "export identity and paste keys to an encrypted archive", run: runBackup},
+		{name: "restore", usage: "restore <file>", help: "merge an encrypted archive into this install", run: runRestore},
+		{name: "put", usage: "put [-file <path>] [-title <t>] [-days 1-7]", help: "upload a file or stdin as an encrypted paste", run: runPut},
+		{name: "get", usage: "get [-o <path>] [-force] <paste id>", help: "download and decrypt a paste to stdout or a file", run: runGet},
+		{name: "keys", usage: "keys doctor [-delete-expired]", help: "check paste keys against the server and delete expired ones", run: runKeys},
+		{name: "dev-server", usage: "dev-server [-addr host:port]", help: "run an in-memory backend for offline development", run: runDevServer},
+	}
+}
+
+// Run executes the subcommand named by args[0].
+func Run(args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, Usage())
+		return nil
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], Usage())
+}
+
+func Usage() string {
+	var b strings.Builder
+	b.WriteString("usage: dropkey [command]\n\nRun without a command to start the TUI.\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  dropkey %-44s %s\n", c.usage, c.help)
+	}
+	return b.String()
+}
+
+// interruptible returns a context that the first Ctrl+C cancels, so a
+// request in flight is abandoned cleanly. A second Ctrl+C exits as usual.
+// Retries of its requests are reported on stderr.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return api.WithRetryHook(ctx, reportRetry), stop
+}
+
+func reportRetry(e api.RetryEvent) {
+	fmt.Fprintf(os.Stderr, "%v, retrying in %s (%d of %d)\n", e.Err, e.Wait.Round(100*time.Millisecond), e.Attempt-1, e.Attempts-1)
+}
+
+// runCmd runs a tea.Cmd from the api package synchronously and turns an
+// api.ErrMsg into a plain error.
+func runCmd(cmd tea.Cmd) (tea.Msg, error) {
+	msg := cmd()
+	if err, ok := msg.(api.ErrMsg); ok {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/devserver"
+)
+
+func runDevServer(args []string) error {
+	flags := flag.NewFlagSet("dev-server", flag.ContinueOnError)
+	addr := flags.String("addr", strings.TrimPrefix(api.DefaultBackendURL, "http://"), "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: dropkey dev-server [-addr host:port]")
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	srv := devserver.New()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		srv.ServeHTTP(rec, r)
+		logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", rec.status)
+	})
+
+	fmt.Fprintf(os.Stderr, "DropKey dev server on http://%s, everything is kept in memory.\n", *addr)
+	fmt.Fprintf(os.Stderr, "Point clients at it with DROPKEY_BACKEND_URL=http://%s\n", *addr)
+	return http.ListenAndServe(*addr, handler)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
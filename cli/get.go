@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/contacts"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/paste"
+)
+
+func runGet(args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	out := flags.String("o", "-", "output file, or a directory to save under the attachment name")
+	force := flags.Bool("force", false, "overwrite the output file if it exists")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: dropkey get [-o <path>] [-force] <paste id>")
+	}
+	id := flags.Arg(0)
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	msg, err := runCmd(api.GetPaste(ctx, id))
+	if err != nil {
+		return err
+	}
+	p := msg.(api.PasteFetchedMsg).Paste
+
+	if !p.Streamed {
+		opened, err := crypt.VerifyAndOpen(keyStore, id, p.Ciphertext, p.Signature, p.PublicKey, knownSigners())
+		if err != nil {
+			return err
+		}
+		if err := reportTrust(opened.Status, p.PublicKey); err != nil {
+			return err
+		}
+		payload, err := paste.Unmarshal(opened.Plaintext)
+		if err != nil {
+			return err
+		}
+		return writeOutput(payload, bytes.NewReader(payload.Body), *out, *force)
+	}
+
+	msg, err = runCmd(api.DownloadPasteStream(ctx, id))
+	if err != nil {
+		return err
+	}
+	download := msg.(api.PasteStreamMsg)
+	defer download.Body.Close()
+
+	opened, err := paste.OpenStream(keyStore, id, download.Body, download.Signature, download.PublicKey, knownSigners())
+	if err != nil {
+		return err
+	}
+	defer opened.Close()
+	if err := reportTrust(opened.Status, download.PublicKey); err != nil {
+		return err
+	}
+	return writeOutput(opened.Payload, opened.Body, *out, *force)
+}
+
+// knownSigners trusts the user's own keys and their contacts, the same
+// keys the TUI badges as known.
+func knownSigners() func(string) bool {
+	own, err := cfgStore.Load()
+	if err != nil {
+		own = &config.Config{}
+	}
+	book, err := contacts.Load(cfgStore)
+	if err != nil {
+		book = &contacts.Book{}
+	}
+	return func(publicKeyB64 string) bool {
+		if own.OwnsKey(publicKeyB64) {
+			return true
+		}
+		_, ok := book.Lookup(publicKeyB64)
+		return ok
+	}
+}
+
+// reportTrust prints the signature status on stderr, keeping stdout for
+// the paste itself, and refuses pastes with a bad signature.
+func reportTrust(status crypt.TrustStatus, publicKeyB64 string) error {
+	if status == crypt.BadSignature {
+		return errors.New("signature does not match the paste contents, refusing to decrypt")
+	}
+	fmt.Fprintf(os.Stderr, "%s · %s\n", status, crypt.Fingerprint(publicKeyB64))
+	return nil
+}
+
+func writeOutput(payload *paste.Payload, body io.Reader, out string, force bool) error {
+	if out == "-" {
+		_, err := io.Copy(os.Stdout, body)
+		return err
+	}
+
+	if info, err := os.Stat(out); err == nil && info.IsDir() {
+		path, err := payload.SaveFrom(out, body)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Saved to %s\n", path)
+		return nil
+	}
+
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(out, mode, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	return f.Close()
+}
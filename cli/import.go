@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+
+	"github.com/charmbracelet/x/term"
+)
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	force := flags.Bool("force", false, "replace an existing identity with a different key")
+	register := flags.Bool("register", false, "register the imported key with the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: dropkey import [-force] [-register] <key file>")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	identity, err := crypt.ParseIdentity(data, nil)
+	if errors.Is(err, crypt.ErrPassphraseRequired) {
+		passphrase, perr := readPassphrase("Passphrase for " + flags.Arg(0) + ": ")
+		if perr != nil {
+			return perr
+		}
+		identity, err = crypt.ParseIdentity(data, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	existing, err := cfgStore.Load()
+	switch {
+	case err == nil && existing.PublicKey == identity.PublicKey:
+		// keep the retired keys and settings of the configured identity
+		fmt.Printf("Identity %s is already configured\n", crypt.Fingerprint(identity.PublicKey))
+
+	case err == nil && existing.PublicKey != "" && !*force:
+		return fmt.Errorf("an identity with fingerprint %s is already configured, use -force to replace it",
+			crypt.Fingerprint(existing.PublicKey))
+
+	default:
+		if err == nil && existing.PublicKey != "" {
+			// the user ID and session belong to the key being replaced
+			if err := cfgStore.ClearUserID(); err != nil {
+				return err
+			}
+		}
+		if err := cfgStore.Save(&config.Config{
+			PublicKey:  identity.PublicKey,
+			PrivateKey: identity.PrivateKey,
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Imported identity %s\n", crypt.Fingerprint(identity.PublicKey))
+	}
+
+	if !*register {
+		return nil
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	msg, err := runCmd(api.RegisterUser(ctx, identity.PublicKey))
+	if err != nil {
+		return err
+	}
+	resp := msg.(api.RegisterUserResponse)
+	if err := cfgStore.SaveUserID(resp.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Registered with user ID %s\n", resp.ID)
+	return nil
+}
+
+// readPassphrase prompts on stderr and reads without echoing.
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
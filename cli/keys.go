@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"Drop-Key-TUI/doctor"
+)
+
+func runKeys(args []string) error {
+	if len(args) == 0 || args[0] != "doctor" {
+		return errors.New("usage: dropkey keys doctor [-delete-expired]")
+	}
+
+	flags := flag.NewFlagSet("keys doctor", flag.ContinueOnError)
+	deleteExpired := flags.Bool("delete-expired", false, "securely delete the keys of expired pastes")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	report, err := doctor.Check(ctx, cfgStore, keyStore)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+
+	expired := report.Expired()
+	if len(expired) == 0 {
+		return nil
+	}
+	if !*deleteExpired {
+		fmt.Println("Run again with -delete-expired to delete them.")
+		return nil
+	}
+	n, err := doctor.Shred(keyStore, expired)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d expired keys.\n", n)
+	return nil
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/paste"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func runPut(args []string) error {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	file := flags.String("file", "", "file to upload, reads stdin when empty or -")
+	title := flags.String("title", "", "paste title, defaults to the file name")
+	days := flags.Int("days", 1, "days until the paste expires (1-7)")
+	compressFlag := flags.String("compress", "", "auto, zstd, gzip or none (default from config, else none)")
+	scanFlag := flags.Bool("scan", false, "check for credentials and personal data before publishing")
+	redact := flags.Bool("redact", false, "with -scan, redact findings without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: dropkey put [-file <path>] [-title <title>] [-days 1-7] [-compress auto|zstd|gzip|none]")
+	}
+	if *days < 1 || *days > 7 {
+		return errors.New("-days must be between 1 and 7")
+	}
+	expiresIn := *days * 86400
+
+	cfg, err := cfgStore.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *compressFlag == "" {
+		*compressFlag = cfg.Compression
+	}
+	compression, err := paste.ParseCompression(*compressFlag)
+	if err != nil {
+		return err
+	}
+	up := uploader{cfg: cfg, compression: compression, expiresIn: expiresIn, scan: *scanFlag || *redact, redact: *redact}
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	var (
+		created *api.CreatePasteResponse
+		payload *paste.Payload
+	)
+	if *file == "" || *file == "-" {
+		created, payload, err = up.putStdin(ctx, *title)
+	} else {
+		created, payload, err = up.putFile(ctx, *file, *title)
+	}
+	if err != nil {
+		return err
+	}
+
+	if payload.IsAttachment() {
+		fmt.Printf("Uploaded %s\n", payload.Describe())
+	}
+	fmt.Printf("Paste ID: %s\n", created.ID)
+	if created.URL != "" {
+		fmt.Printf("URL: %s\n", created.URL)
+	}
+	return nil
+}
+
+// uploader holds what every upload of one `dropkey put` run shares
+type uploader struct {
+	cfg         *config.Config
+	compression paste.Compression
+	expiresIn   int
+	scan        bool
+	redact      bool
+}
+
+// putFile uploads small files as regular pastes, so every client can open
+// them, and streams anything larger.
+func (u uploader) putFile(ctx context.Context, path, title string) (*api.CreatePasteResponse, *paste.Payload, error) {
+	payload, f, err := paste.OpenFile(path, title)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	if payload.Size <= paste.MaxSize {
+		payload.Body, err = io.ReadAll(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		payload.Size = int64(len(payload.Body))
+		created, err := u.createPaste(ctx, payload)
+		return created, payload, err
+	}
+
+	created, err := u.createStreamPaste(ctx, payload, f)
+	return created, payload, err
+}
+
+// putStdin reads up to paste.MaxSize from stdin. If the input ends there it
+// becomes a regular paste, otherwise what was read is streamed followed
+// by the rest of stdin.
+func (u uploader) putStdin(ctx context.Context, title string) (*api.CreatePasteResponse, *paste.Payload, error) {
+	if title == "" {
+		title = "stdin"
+	}
+
+	head, err := io.ReadAll(io.LimitReader(os.Stdin, paste.MaxSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(head) <= paste.MaxSize {
+		payload := paste.Text(title, string(head))
+		if !utf8.Valid(head) {
+			payload = &paste.Payload{Title: title, Filename: "stdin.bin", MIME: "application/octet-stream", Size: int64(len(head)), Body: head}
+		}
+		created, err := u.createPaste(ctx, payload)
+		return created, payload, err
+	}
+
+	payload := &paste.Payload{Title: title, Filename: "stdin.bin", MIME: "application/octet-stream", Size: -1}
+	created, err := u.createStreamPaste(ctx, payload, io.MultiReader(bytes.NewReader(head), os.Stdin))
+	return created, payload, err
+}
+
+// createPaste seals the payload, uploads it and moves its key from the
+// temporary ID to the one the server assigned.
+func (u uploader) createPaste(ctx context.Context, payload *paste.Payload) (*api.CreatePasteResponse, error) {
+	if u.scan {
+		if err := u.review(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	sealed, err := paste.Seal(keyStore, payload, u.compression, u.cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	req := api.PasteRequest{
+		Ciphertext:     sealed.Ciphertext,
+		Signature:      sealed.Signature,
+		PublicKey:      u.cfg.PublicKey,
+		ExpiresIn:      u.expiresIn,
+		TitleHeader:    sealed.TitleHeader,
+		TitleSignature: sealed.TitleSignature,
+	}
+
+	token, err := sessionToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := runCmd(api.CreatePaste(ctx, req, token, sealed.TempID))
+	if unauthorized, ok := msg.(api.UnauthorizedMsg); ok {
+		// the cached token was revoked, sign in again once
+		if err := cfgStore.ClearToken(); err != nil {
+			return nil, err
+		}
+		if token, err = sessionToken(ctx); err != nil {
+			return nil, err
+		}
+		msg, err = runCmd(unauthorized.Retry(token))
+	}
+	return finishCreate(msg, err, sealed.TempID)
+}
+
+// createStreamPaste encrypts body in chunks while it is uploaded, so
+// memory use does not grow with the size of the paste.
+func (u uploader) createStreamPaste(ctx context.Context, payload *paste.Payload, body io.Reader) (*api.CreatePasteResponse, error) {
+	if u.scan {
+		return nil, fmt.Errorf("-scan only works for pastes up to %d MiB", paste.MaxSize>>20)
+	}
+	token, err := sessionToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := paste.SealStream(keyStore, payload, body, u.compression, u.cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := runCmd(api.UploadPasteStream(ctx, api.StreamUpload{
+		PublicKey:      u.cfg.PublicKey,
+		ExpiresIn:      u.expiresIn,
+		TitleHeader:    sealed.TitleHeader,
+		TitleSignature: sealed.TitleSignature,
+		Body:           sealed,
+		Signature:      sealed.Signature,
+	}, token, sealed.TempID))
+	return finishCreate(msg, err, sealed.TempID)
+}
+
+func finishCreate(msg tea.Msg, err error, tempID string) (*api.CreatePasteResponse, error) {
+	created, ok := msg.(api.PasteCreatedMsg)
+	rejected := false
+	if failed, isFailed := msg.(api.PasteCreateFailedMsg); isFailed {
+		err, rejected = failed.Err, failed.Rejected
+	} else if err == nil && !ok {
+		// still unauthorized after signing in again
+		err, rejected = api.ErrUnauthorized, true
+	}
+	if err != nil {
+		// the key is useless without a paste to go with it. If the server
+		// may have stored the paste anyway it is kept, the key check in
+		// settings can match it to the paste ID later
+		if rejected {
+			keyStore.DeleteKey(tempID)
+		}
+		return nil, err
+	}
+	if err := crypt.MoveKey(keyStore, created.TempID, created.ID); err != nil {
+		return nil, err
+	}
+	return &created.CreatePasteResponse, nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"Drop-Key-TUI/paste"
+	"Drop-Key-TUI/scan"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// review runs the secret scan on a text payload. Findings are listed on
+// stderr, then redacted, published anyway or the upload is cancelled,
+// the same choices the Create tab offers. Without a terminal to ask on,
+// the upload is cancelled unless -redact was given.
+func (u uploader) review(payload *paste.Payload) error {
+	if !payload.IsText() {
+		return nil
+	}
+	findings := scan.Scan(string(payload.Body))
+	if len(findings) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Found %s:\n", scan.Summary(findings))
+	for _, f := range findings {
+		fmt.Fprintf(os.Stderr, "  %s\n", f)
+	}
+
+	choice := "r"
+	if !u.redact {
+		if !term.IsTerminal(os.Stdin.Fd()) {
+			return errors.New("paste not published, rerun with -redact to redact the findings or without -scan to publish as is")
+		}
+		fmt.Fprint(os.Stderr, "[r]edact, [p]ublish as is or [c]ancel? ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read answer: %w", err)
+		}
+		choice = strings.ToLower(strings.TrimSpace(line))
+	}
+
+	switch choice {
+	case "r", "redact":
+		redacted := scan.Redact(string(payload.Body), findings)
+		payload.Body = []byte(redacted)
+		payload.Size = int64(len(redacted))
+		fmt.Fprintf(os.Stderr, "Redacted %d findings\n", len(findings))
+		return nil
+	case "p", "publish":
+		return nil
+	}
+	return errors.New("paste not published")
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+)
+
+// sessionToken returns the cached bearer token, signing a fresh challenge
+// when it has expired. The new token is cached for the TUI as well.
+func sessionToken(ctx context.Context) (string, error) {
+	if token, err := cfgStore.LoadToken(); err == nil && token.Valid() {
+		return token.Value, nil
+	}
+
+	userID, err := cfgStore.LoadUserID()
+	if err != nil {
+		return "", errors.New("not registered yet, start dropkey without a command to register")
+	}
+	cfg, err := cfgStore.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	privKey, err := base64.StdEncoding.DecodeString(cfg.PrivateKey)
+	if err != nil || len(privKey) != ed25519.PrivateKeySize {
+		return "", errors.New("configured private key is invalid")
+	}
+
+	msg, err := runCmd(api.RequestChallenge(ctx, userID))
+	if err != nil {
+		return "", err
+	}
+	challenge := msg.(api.ChallengeMsg)
+
+	signature := ed25519.Sign(privKey, api.ChallengeMessage(userID, challenge.Nonce))
+	msg, err = runCmd(api.AuthenticateUser(ctx, api.AuthRequest{
+		ID:        userID,
+		PublicKey: cfg.PublicKey,
+		Signature: base64.StdEncoding.EncodeToString(signature),
+		Challenge: challenge.Nonce,
+	}))
+	if err != nil {
+		return "", err
+	}
+	auth, ok := msg.(api.AuthResponse)
+	if !ok {
+		return "", fmt.Errorf("authentication failed: %v", msg)
+	}
+
+	if err := cfgStore.SaveToken(config.Token{Value: auth.Token, ExpiresAt: auth.Expiry()}); err != nil {
+		return "", err
+	}
+	return auth.Token, nil
+}
@@ -8,14 +8,66 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
+
+	"Drop-Key-TUI/fsutil"
 )
 
 type Config struct {
-	PublicKey  string `json:"public_key"`
-	PrivateKey string `json:"private_key"`
+	PublicKey    string       `json:"public_key"`
+	PrivateKey   string       `json:"private_key"`
+	PreviousKeys []RetiredKey `json:"previous_keys,omitempty"`
+	// Compression is "none" (the default), "auto", "zstd" or "gzip".
+	// Only turn it on once contacts run clients that can read compressed
+	// pastes.
+	Compression string `json:"compression,omitempty"`
+}
+
+// RetiredKey is an identity key that was replaced by a rotation. Only the
+// public half is kept, so pastes signed before the rotation still verify.
+type RetiredKey struct {
+	PublicKey string    `json:"public_key"`
+	RetiredAt time.Time `json:"retired_at"`
+	// Signature is the old key's endorsement of the key that replaced it.
+	Signature string `json:"signature"`
+}
+
+// Rotate replaces the identity key pair and retires the current public key.
+func (c *Config) Rotate(newPublicKey, newPrivateKey, endorsement string, at time.Time) {
+	c.PreviousKeys = append(c.PreviousKeys, RetiredKey{
+		PublicKey: c.PublicKey,
+		RetiredAt: at,
+		Signature: endorsement,
+	})
+	c.PublicKey = newPublicKey
+	c.PrivateKey = newPrivateKey
+}
+
+// PublicKeys returns the current identity key followed by the retired
+// ones, every key the user's pastes can be signed with.
+func (c *Config) PublicKeys() []string {
+	keys := []string{c.PublicKey}
+	for _, k := range c.PreviousKeys {
+		keys = append(keys, k.PublicKey)
+	}
+	return keys
 }
 
-func getConfigPath() (string, error) {
+// OwnsKey reports whether publicKey is the current or a retired identity key.
+func (c *Config) OwnsKey(publicKey string) bool {
+	if publicKey == c.PublicKey {
+		return true
+	}
+	for _, k := range c.PreviousKeys {
+		if k.PublicKey == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Dir returns the application config directory, creating it if needed.
+func Dir() (string, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
 		slog.Error("Could not get user config directory")
@@ -28,11 +80,20 @@ func getConfigPath() (string, error) {
 		return "", fmt.Errorf("could not create app config directory: %w", err)
 	}
 
+	return appConfigDir, nil
+}
+
+func (s FSStore) configPath() (string, error) {
+	appConfigDir, err := s.appDir()
+	if err != nil {
+		return "", err
+	}
+
 	return filepath.Join(appConfigDir, "config.json"), nil
 }
 
-func Load() (*Config, error) {
-	configPath, err := getConfigPath()
+func (s FSStore) Load() (*Config, error) {
+	configPath, err := s.configPath()
 	if err != nil {
 		return nil, err
 	}
@@ -59,12 +120,12 @@ func Load() (*Config, error) {
 	return &config, nil
 }
 
-func Save(config *Config) error {
+func (s FSStore) Save(config *Config) error {
 	if config.PublicKey == "" || config.PrivateKey == "" {
 		return errors.New("cannot save incomplete config")
 	}
 
-	configPath, err := getConfigPath()
+	configPath, err := s.configPath()
 	if err != nil {
 		return err
 	}
@@ -74,9 +135,15 @@ func Save(config *Config) error {
 		return fmt.Errorf("failed to marshal config to JSON: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, jsonBody, 0o600); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+	unlock, err := fsutil.Lock(filepath.Join(filepath.Dir(configPath), ".lock"))
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
+	// a crash halfway through never leaves a truncated identity behind
+	if err := fsutil.WriteFile(configPath, jsonBody, 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
 	return nil
 }
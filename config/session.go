@@ -1,18 +1,40 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
+
+	"Drop-Key-TUI/fsutil"
 )
 
 const (
 	appName     = "pasteapp"
 	sessionFile = "session"
+	tokenFile   = "token"
 )
 
-func getSessionPath() (string, error) {
-	dir, err := os.UserConfigDir()
+// tokenExpiryMargin keeps a token from being reused right before it expires,
+// so requests do not race the server clock.
+const tokenExpiryMargin = 30 * time.Second
+
+// Token is the bearer token issued by the server together with its expiry.
+type Token struct {
+	Value     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Valid reports whether the token can still be used for requests.
+func (t *Token) Valid() bool {
+	return t != nil && t.Value != "" && time.Now().Add(tokenExpiryMargin).Before(t.ExpiresAt)
+}
+
+func (s FSStore) sessionPath() (string, error) {
+	dir, err := s.root()
 	if err != nil {
 		return "", err
 	}
@@ -20,20 +42,34 @@ func getSessionPath() (string, error) {
 	return path, nil
 }
 
-func SaveUserID(userID string) error {
-	path, err := getSessionPath()
+func (s FSStore) tokenPath() (string, error) {
+	dir, err := s.root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, tokenFile), nil
+}
+
+// sessionLock locks the session directory holding path, creating it first
+func sessionLock(path string) (func(), error) {
+	return fsutil.Lock(filepath.Join(filepath.Dir(path), ".lock"))
+}
+
+func (s FSStore) SaveUserID(userID string) error {
+	path, err := s.sessionPath()
 	if err != nil {
 		return err
 	}
-	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	unlock, err := sessionLock(path)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, []byte(userID), 0o600)
+	defer unlock()
+	return fsutil.WriteFile(path, []byte(userID), 0o600)
 }
 
-func LoadUserID() (string, error) {
-	path, err := getSessionPath()
+func (s FSStore) LoadUserID() (string, error) {
+	path, err := s.sessionPath()
 	if err != nil {
 		return "", err
 	}
@@ -48,10 +84,68 @@ func LoadUserID() (string, error) {
 	return userID, nil
 }
 
-func ClearUserID() error {
-	path, err := getSessionPath()
+// ClearUserID logs the user out by removing both the stored user ID and
+// the cached bearer token.
+func (s FSStore) ClearUserID() error {
+	if err := s.ClearToken(); err != nil {
+		return err
+	}
+	path, err := s.sessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SaveToken stores the bearer token so later launches can skip signing a
+// new challenge. The file is only readable by the current user.
+func (s FSStore) SaveToken(token Token) error {
+	path, err := s.tokenPath()
 	if err != nil {
 		return err
 	}
-	return os.Remove(path)
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	unlock, err := sessionLock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fsutil.WriteFile(path, data, 0o600)
+}
+
+// LoadToken returns the stored bearer token. Callers should check Valid
+// before using it.
+func (s FSStore) LoadToken() (*Token, error) {
+	path, err := s.tokenPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %w", err)
+	}
+	return &token, nil
+}
+
+func (s FSStore) ClearToken() error {
+	path, err := s.tokenPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists the identity, the user ID and the bearer token between
+// launches.
+type Store interface {
+	Load() (*Config, error)
+	Save(config *Config) error
+
+	LoadUserID() (string, error)
+	SaveUserID(userID string) error
+	// ClearUserID also drops the token, it is what logging out does
+	ClearUserID() error
+
+	LoadToken() (*Token, error)
+	SaveToken(token Token) error
+	ClearToken() error
+
+	// Dir is where the drafts, contacts and templates are kept
+	Dir() (string, error)
+}
+
+// ErrNoDir is returned by MemoryStore.Dir unless it was given a directory
+var ErrNoDir = errors.New("no directory for drafts, contacts and templates")
+
+// FSStore keeps everything under Root, or the OS config directory when
+// Root is empty: the identity in Drop-Key-TUI/config.json and the session
+// in pasteapp/.
+type FSStore struct {
+	Root string
+}
+
+func (s FSStore) root() (string, error) {
+	if s.Root != "" {
+		return s.Root, nil
+	}
+	return os.UserConfigDir()
+}
+
+// Dir returns the app directory next to config.json
+func (s FSStore) Dir() (string, error) {
+	return s.appDir()
+}
+
+func (s FSStore) appDir() (string, error) {
+	if s.Root == "" {
+		return Dir()
+	}
+
+	appConfigDir := filepath.Join(s.Root, "Drop-Key-TUI")
+	if err := os.MkdirAll(appConfigDir, 0o755); err != nil {
+		return "", fmt.Errorf("could not create app config directory: %w", err)
+	}
+	return appConfigDir, nil
+}
+
+// MemoryStore keeps everything in memory, for tests and throwaway sessions.
+// Drafts, contacts and templates only work once UseDir gave it a directory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	config *Config
+	userID string
+	token  *Token
+	dir    string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() (*Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config == nil {
+		return nil, fmt.Errorf("config file not found, please register first")
+	}
+	c := cloneConfig(s.config)
+	return &c, nil
+}
+
+func (s *MemoryStore) Save(config *Config) error {
+	if config.PublicKey == "" || config.PrivateKey == "" {
+		return errors.New("cannot save incomplete config")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := cloneConfig(config)
+	s.config = &c
+	return nil
+}
+
+func (s *MemoryStore) LoadUserID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userID == "" {
+		return "", errors.New("no user ID found")
+	}
+	return s.userID, nil
+}
+
+func (s *MemoryStore) SaveUserID(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userID = userID
+	return nil
+}
+
+func (s *MemoryStore) ClearUserID() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userID = ""
+	s.token = nil
+	return nil
+}
+
+func (s *MemoryStore) LoadToken() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, errors.New("no token found")
+	}
+	t := *s.token
+	return &t, nil
+}
+
+func (s *MemoryStore) SaveToken(token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = &token
+	return nil
+}
+
+func (s *MemoryStore) ClearToken() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+	return nil
+}
+
+// UseDir keeps drafts, contacts and templates under dir
+func (s *MemoryStore) UseDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+}
+
+func (s *MemoryStore) Dir() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return "", ErrNoDir
+	}
+	return s.dir, nil
+}
+
+// cloneConfig copies c so callers cannot change the stored config in place
+func cloneConfig(c *Config) Config {
+	out := *c
+	out.PreviousKeys = append([]RetiredKey(nil), c.PreviousKeys...)
+	return out
+}
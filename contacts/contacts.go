@@ -0,0 +1,197 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/fsutil"
+)
+
+const contactsFile = "contacts.json"
+
+// TrustLevel records how a contact's key was learned.
+type TrustLevel string
+
+const (
+	// TOFU means the key was accepted the first time it was seen
+	// (trust on first use) without comparing fingerprints.
+	TOFU TrustLevel = "tofu"
+	// Verified means the fingerprint was compared out of band.
+	Verified TrustLevel = "verified"
+)
+
+type Contact struct {
+	Name        string     `json:"name"`
+	PublicKey   string     `json:"public_key"`
+	Fingerprint string     `json:"fingerprint"`
+	Trust       TrustLevel `json:"trust"`
+	AddedAt     time.Time  `json:"added_at"`
+	// History holds the keys this contact rotated away from, oldest first.
+	History []KeyChange `json:"history,omitempty"`
+}
+
+// KeyChange is one link of a contact's rotation chain.
+type KeyChange struct {
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	RotatedAt   time.Time `json:"rotated_at"`
+}
+
+// IsCurrent reports whether publicKey is the contact's current key rather
+// than one from its rotation history.
+func (c *Contact) IsCurrent(publicKeyB64 string) bool {
+	return c.PublicKey == publicKeyB64
+}
+
+// Book is the local address book mapping signing keys to names.
+type Book struct {
+	Contacts []Contact `json:"contacts"`
+
+	// path is where Load read the book from, and Save writes it
+	path string
+}
+
+// Load reads the address book kept in the directory of store. A missing
+// file is an empty book.
+func Load(store config.Store) (*Book, error) {
+	dir, err := store.Dir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, contactsFile)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &Book{path: path}, nil
+		}
+		return nil, fmt.Errorf("failed to read contacts file: %w", err)
+	}
+
+	book := Book{path: path}
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, fmt.Errorf("failed to decode contacts JSON: %w", err)
+	}
+	return &book, nil
+}
+
+// Save writes the book back where Load found it.
+func (b *Book) Save() error {
+	if b.path == "" {
+		return errors.New("contacts book was not loaded from a store")
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal contacts to JSON: %w", err)
+	}
+
+	unlock, err := fsutil.Lock(filepath.Join(filepath.Dir(b.path), ".lock"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := fsutil.WriteFile(b.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write contacts file: %w", err)
+	}
+	return nil
+}
+
+// Lookup finds the contact owning a base64 public key, either as their
+// current key or one they rotated away from.
+func (b *Book) Lookup(publicKeyB64 string) (*Contact, bool) {
+	for i := range b.Contacts {
+		if b.Contacts[i].PublicKey == publicKeyB64 {
+			return &b.Contacts[i], true
+		}
+	}
+	for i := range b.Contacts {
+		for _, h := range b.Contacts[i].History {
+			if h.PublicKey == publicKeyB64 {
+				return &b.Contacts[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ApplyRotations follows verified rotation statements, oldest first, and
+// moves every contact whose current key was rotated onto its new key. The
+// trust level carries over because the old key endorsed the new one. It
+// returns the contacts that changed.
+func (b *Book) ApplyRotations(rotations []crypt.RotationStatement) []Contact {
+	var changed []Contact
+	for _, r := range rotations {
+		for i := range b.Contacts {
+			c := &b.Contacts[i]
+			if c.PublicKey != r.OldPublicKey {
+				continue
+			}
+			c.History = append(c.History, KeyChange{
+				PublicKey:   c.PublicKey,
+				Fingerprint: c.Fingerprint,
+				RotatedAt:   r.RotatedAt,
+			})
+			c.PublicKey = r.NewPublicKey
+			c.Fingerprint = crypt.Fingerprint(r.NewPublicKey)
+			changed = append(changed, *c)
+		}
+	}
+	return changed
+}
+
+// Add stores a new contact, or renames an existing one with the same key.
+// A name can only belong to one key so a look-alike cannot take it over.
+func (b *Book) Add(name, publicKeyB64 string, trust TrustLevel) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("contact name cannot be empty")
+	}
+
+	fingerprint := crypt.Fingerprint(publicKeyB64)
+	if fingerprint == "" {
+		return errors.New("invalid public key")
+	}
+
+	for _, c := range b.Contacts {
+		if strings.EqualFold(c.Name, name) && c.PublicKey != publicKeyB64 {
+			return fmt.Errorf("a different key is already saved as %q", c.Name)
+		}
+	}
+
+	if c, ok := b.Lookup(publicKeyB64); ok {
+		c.Name = name
+		if trust == Verified {
+			c.Trust = Verified
+		}
+		return nil
+	}
+
+	b.Contacts = append(b.Contacts, Contact{
+		Name:        name,
+		PublicKey:   publicKeyB64,
+		Fingerprint: fingerprint,
+		Trust:       trust,
+		AddedAt:     time.Now().UTC(),
+	})
+	return nil
+}
+
+// MarkVerified records that the user compared the contact's fingerprint.
+func (b *Book) MarkVerified(publicKeyB64 string) error {
+	c, ok := b.Lookup(publicKeyB64)
+	if !ok {
+		return errors.New("contact not found")
+	}
+	c.Trust = Verified
+	return nil
+}
@@ -9,67 +9,78 @@ import (
 	"io"
 )
 
-func EncryptPaste(id string, text []byte) (string, error) {
-	key, err := GenerateKey(id)
+// EncryptPaste seals text under a new key stored for id and returns the
+// nonce followed by the ciphertext. It is base64 encoded once, for the
+// JSON request, by the caller.
+func EncryptPaste(ks KeyStore, id string, text []byte) ([]byte, error) {
+	key, err := GenerateKey(ks, id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, text, nil)
-	return string(ciphertext), nil
+	return gcm.Seal(nonce, nonce, text, nil), nil
 }
 
-func DecryptPaste(id, ciphertextB64 string) (string, error) {
-	key, err := GetKey(id)
+func DecryptPaste(ks KeyStore, id, ciphertextB64 string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
 	if err != nil {
 		return "", err
 	}
-	if len(key) != 32 {
-		return "", fmt.Errorf("invalid key length: must be 32 bytes for AES-256")
-	}
 
-	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	plaintext, err := open(ks, id, ciphertext)
 	if err != nil {
 		return "", err
 	}
 
+	return string(plaintext), nil
+}
+
+// open decrypts raw AES-GCM ciphertext with the stored key for id
+func open(ks KeyStore, id string, ciphertext []byte) ([]byte, error) {
+	key, err := ks.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	return openWithKey(key, ciphertext)
+}
+
+func openWithKey(key, ciphertext []byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key length: must be 32 bytes for AES-256")
+	}
+
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+		return nil, fmt.Errorf("ciphertext too short")
 	}
 
 	nonce := ciphertext[:nonceSize]
 	ciphertext = ciphertext[nonceSize:]
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", err
-	}
-
-	return string(plaintext), nil
+	return gcm.Open(nil, nonce, ciphertext, nil)
 }
@@ -0,0 +1,30 @@
+package crypt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// fingerprintBytes is how much of the key hash is shown to users
+const fingerprintBytes = 8
+
+// Fingerprint returns a short, human comparable fingerprint of a base64
+// Ed25519 public key, e.g. "3f2a 9c41 07be d8e5". It returns an empty
+// string when the key cannot be decoded.
+func Fingerprint(publicKeyB64 string) string {
+	pubKey, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	if err != nil || len(pubKey) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(pubKey)
+	encoded := hex.EncodeToString(sum[:fingerprintBytes])
+
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
@@ -0,0 +1,155 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrPassphraseRequired is returned by ParseIdentity for an encrypted
+// OpenSSH key when no passphrase was given.
+var ErrPassphraseRequired = errors.New("key is protected by a passphrase")
+
+// Identity is an Ed25519 key pair in the base64 form stored in the config.
+type Identity struct {
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+}
+
+// ParseIdentity reads an Ed25519 identity from any of the formats people
+// already have lying around:
+//
+//   - the DropKey JSON file with base64 public_key/private_key fields
+//   - OpenSSH private keys (~/.ssh/id_ed25519), optionally passphrase protected
+//   - unencrypted PKCS#8 PEM ("BEGIN PRIVATE KEY")
+//   - a raw 32-byte seed, as bytes, base64 or hex
+//
+// The public key is always checked against the private key before the
+// identity is returned.
+func ParseIdentity(data, passphrase []byte) (*Identity, error) {
+	// a raw seed is binary, any of its bytes may look like whitespace or
+	// a brace, only the text formats are trimmed
+	if len(data) == ed25519.SeedSize {
+		return identityFromPrivateKey(ed25519.NewKeyFromSeed(data))
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("key file is empty")
+	}
+
+	if data[0] == '{' {
+		return parseJSONIdentity(data)
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		priv, err := parsePEMIdentity(block, data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return identityFromPrivateKey(priv)
+	}
+
+	seed, err := decodeSeed(data)
+	if err != nil {
+		return nil, err
+	}
+	return identityFromPrivateKey(ed25519.NewKeyFromSeed(seed))
+}
+
+func parseJSONIdentity(data []byte) (*Identity, error) {
+	var keys Identity
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode keys JSON: %w", err)
+	}
+
+	priv, err := base64.StdEncoding.DecodeString(keys.PrivateKey)
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("private_key is not a base64 Ed25519 private key")
+	}
+
+	identity, err := identityFromPrivateKey(ed25519.PrivateKey(priv))
+	if err != nil {
+		return nil, err
+	}
+	if keys.PublicKey != "" && keys.PublicKey != identity.PublicKey {
+		return nil, errors.New("public_key does not match private_key")
+	}
+	return identity, nil
+}
+
+func parsePEMIdentity(block *pem.Block, data, passphrase []byte) (ed25519.PrivateKey, error) {
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err := ssh.ParseRawPrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if len(passphrase) == 0 {
+				return nil, ErrPassphraseRequired
+			}
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OpenSSH key: %w", err)
+		}
+		priv, ok := key.(*ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("OpenSSH key is %T, only ed25519 keys are supported", key)
+		}
+		return *priv, nil
+
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 key: %w", err)
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS#8 key is %T, only ed25519 keys are supported", key)
+		}
+		return priv, nil
+
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, errors.New("encrypted PKCS#8 keys are not supported, decrypt it with `openssl pkcs8` first")
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// decodeSeed accepts a 32-byte seed as hex or base64, raw seeds are
+// picked up by ParseIdentity before the input is trimmed.
+func decodeSeed(data []byte) ([]byte, error) {
+	if seed, err := hex.DecodeString(string(data)); err == nil && len(seed) == ed25519.SeedSize {
+		return seed, nil
+	}
+	if seed, err := base64.StdEncoding.DecodeString(string(data)); err == nil && len(seed) == ed25519.SeedSize {
+		return seed, nil
+	}
+	return nil, errors.New("unrecognised key format: expected DropKey JSON, OpenSSH, PKCS#8 PEM or a 32-byte seed")
+}
+
+// identityFromPrivateKey rebuilds the key pair from the seed and checks
+// that the public half embedded in the private key matches it.
+func identityFromPrivateKey(priv ed25519.PrivateKey) (*Identity, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key length")
+	}
+
+	derived := ed25519.NewKeyFromSeed(priv.Seed())
+	if !bytes.Equal(derived, priv) {
+		return nil, errors.New("public key does not match private key")
+	}
+
+	return &Identity{
+		PublicKey:  base64.StdEncoding.EncodeToString(derived.Public().(ed25519.PublicKey)),
+		PrivateKey: base64.StdEncoding.EncodeToString(derived),
+	}, nil
+}
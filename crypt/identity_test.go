@@ -0,0 +1,47 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseIdentitySeeds(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	want := base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+
+	edges := map[string][]byte{
+		"leading space":    append([]byte{' '}, seed[1:]...),
+		"trailing newline": append(append([]byte{}, seed[:31]...), '\n'),
+		"leading brace":    append([]byte{'{'}, seed[1:]...),
+	}
+	for name, raw := range edges {
+		t.Run(name, func(t *testing.T) {
+			identity, err := ParseIdentity(raw, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pub := ed25519.NewKeyFromSeed(raw).Public().(ed25519.PublicKey)
+			if identity.PublicKey != base64.StdEncoding.EncodeToString(pub) {
+				t.Fatal("raw seed was not read as is")
+			}
+		})
+	}
+
+	for name, text := range map[string]string{
+		"hex":    hex.EncodeToString(seed) + "\n",
+		"base64": "  " + base64.StdEncoding.EncodeToString(seed) + "\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			identity, err := ParseIdentity([]byte(text), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.PublicKey != want {
+				t.Fatal("wrong public key")
+			}
+		})
+	}
+}
@@ -4,12 +4,40 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"Drop-Key-TUI/fsutil"
 )
 
-// getKeyDir returns the full path to the keys directory in OS config dir
-func getKeyDir() (string, error) {
+// ErrKeyNotFound is returned when no key is stored for a paste ID.
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyStore holds the 32-byte AES key of every paste, by paste ID.
+type KeyStore interface {
+	GetKey(id string) ([]byte, error)
+	SaveKey(id string, key []byte) error
+	DeleteKey(id string) error
+	ListKeys() ([]string, error)
+}
+
+// FSKeyStore keeps each key base64 encoded in <Dir>/<id>.key. An empty Dir
+// means the DropKey/keys folder of the OS config directory. Writes are
+// atomic and serialized across processes with a lock file in Dir.
+type FSKeyStore struct {
+	Dir string
+}
+
+// keyDir returns the full path to the keys directory
+func (s FSKeyStore) keyDir() (string, error) {
+	if s.Dir != "" {
+		return s.Dir, nil
+	}
 	dir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
@@ -17,62 +45,60 @@ func getKeyDir() (string, error) {
 	return filepath.Join(dir, "DropKey", "keys"), nil
 }
 
-func ensureKeyDirExists() error {
-	keyDir, err := getKeyDir()
+// lock takes the store-wide lock, held for every change to the directory
+func (s FSKeyStore) lock() (func(), error) {
+	keyDir, err := s.keyDir()
 	if err != nil {
-		return err
-	}
-	return os.MkdirAll(keyDir, 0o700)
-}
-
-// GenerateKey creates a new 32-byte key, stores it as base64 in a file
-func GenerateKey(id string) ([]byte, error) {
-	if err := ensureKeyDirExists(); err != nil {
 		return nil, err
 	}
+	return fsutil.Lock(filepath.Join(keyDir, ".lock"))
+}
 
-	key := make([]byte, 32)
-	if _, err := rand.Read(key); err != nil {
-		return nil, err
+func (s FSKeyStore) keyPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return "", errors.New("invalid key ID")
 	}
-
-	if err := SaveKey(id, key); err != nil {
-		return nil, err
+	keyDir, err := s.keyDir()
+	if err != nil {
+		return "", err
 	}
-	return key, nil
+	return filepath.Join(keyDir, id+".key"), nil
 }
 
 // SaveKey writes the provided 32-byte key (AES-256) to a base64-encoded file by ID
-func SaveKey(id string, key []byte) error {
-	if err := ensureKeyDirExists(); err != nil {
-		return err
-	}
-
+func (s FSKeyStore) SaveKey(id string, key []byte) error {
 	if len(key) != 32 {
 		return errors.New("key must be 32 bytes")
 	}
 
-	keyDir, err := getKeyDir()
+	keyPath, err := s.keyPath(id)
 	if err != nil {
 		return err
 	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	encoded := base64.StdEncoding.EncodeToString(key)
-	keyPath := filepath.Join(keyDir, id+".key")
-	return os.WriteFile(keyPath, []byte(encoded), 0o600)
+	return fsutil.WriteFile(keyPath, []byte(encoded), 0o600)
 }
 
 // GetKey reads a base64-encoded key from a file by ID
-func GetKey(id string) ([]byte, error) {
-	keyDir, err := getKeyDir()
+func (s FSKeyStore) GetKey(id string) ([]byte, error) {
+	keyPath, err := s.keyPath(id)
 	if err != nil {
 		return nil, err
 	}
 
-	keyPath := filepath.Join(keyDir, id+".key")
 	data, err := os.ReadFile(keyPath)
 	if err != nil {
-		return nil, errors.New("key not found")
+		return nil, ErrKeyNotFound
 	}
 
 	key, err := base64.StdEncoding.DecodeString(string(data))
@@ -86,24 +112,235 @@ func GetKey(id string) ([]byte, error) {
 }
 
 // DeleteKey removes a stored key
-func DeleteKey(id string) error {
-	keyDir, err := getKeyDir()
+func (s FSKeyStore) DeleteKey(id string) error {
+	keyPath, err := s.keyPath(id)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	keyPath := filepath.Join(keyDir, id+".key")
-	return os.Remove(keyPath)
+	if err := os.Remove(keyPath); err != nil {
+		return err
+	}
+	return fsutil.SyncDir(filepath.Dir(keyPath))
 }
 
-// MoveKey renames a key file from tempID.key to realID.key
-func MoveKey(tempID, realID string) error {
-	key, err := GetKey(tempID)
+// MoveKey renames the key file, so at every point exactly one of the two
+// IDs has the key.
+func (s FSKeyStore) MoveKey(tempID, realID string) error {
+	tempPath, err := s.keyPath(tempID)
+	if err != nil {
+		return err
+	}
+	realPath, err := s.keyPath(realID)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(tempPath); err != nil {
+		return ErrKeyNotFound
+	}
+	return fsutil.Rename(tempPath, realPath)
+}
+
+// ShredKey overwrites the key file with random bytes and syncs it before
+// removing it, so the key is not left in the freed blocks. Journaling and
+// copy-on-write filesystems or SSD wear levelling can still keep an old
+// copy, this only makes recovery harder.
+func (s FSKeyStore) ShredKey(id string) error {
+	keyPath, err := s.keyPath(id)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(keyPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		noise := make([]byte, info.Size())
+		rand.Read(noise)
+		_, err = f.WriteAt(noise, 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to overwrite key %s: %w", id, err)
+	}
+
+	if err := os.Remove(keyPath); err != nil {
+		return err
+	}
+	return fsutil.SyncDir(filepath.Dir(keyPath))
+}
+
+// ListKeys returns the IDs of every stored key
+func (s FSKeyStore) ListKeys() ([]string, error) {
+	keyDir, err := s.keyDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(keyDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".key") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(e.Name(), ".key"))
+	}
+	return ids, nil
+}
+
+// MemoryKeyStore keeps keys in memory only, for tests and for sessions
+// that should leave nothing behind.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[string][]byte{}}
+}
+
+func (s *MemoryKeyStore) SaveKey(id string, key []byte) error {
+	if len(key) != 32 {
+		return errors.New("key must be 32 bytes")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+func (s *MemoryKeyStore) GetKey(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), key...), nil
+}
+
+func (s *MemoryKeyStore) DeleteKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *MemoryKeyStore) MoveKey(tempID, realID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[tempID]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	s.keys[realID] = key
+	delete(s.keys, tempID)
+	return nil
+}
+
+func (s *MemoryKeyStore) ShredKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	clear(key)
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *MemoryKeyStore) ListKeys() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GenerateKey creates a new 32-byte key and stores it for id
+func GenerateKey(ks KeyStore, id string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if err := ks.SaveKey(id, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyShredder is implemented by stores that can erase a key for good
+type keyShredder interface {
+	ShredKey(id string) error
+}
+
+// ShredKey deletes a key so that it cannot be read back from the disk, on
+// stores that support it, and falls back to DeleteKey otherwise.
+func ShredKey(ks KeyStore, id string) error {
+	if s, ok := ks.(keyShredder); ok {
+		return s.ShredKey(id)
+	}
+	return ks.DeleteKey(id)
+}
+
+// keyMover is implemented by stores that can move a key atomically
+type keyMover interface {
+	MoveKey(tempID, realID string) error
+}
+
+// MoveKey stores the key of tempID under realID and removes the old entry.
+// Stores that can do this atomically implement MoveKey themselves, the
+// others get a copy followed by a delete.
+func MoveKey(ks KeyStore, tempID, realID string) error {
+	if m, ok := ks.(keyMover); ok {
+		return m.MoveKey(tempID, realID)
+	}
+
+	key, err := ks.GetKey(tempID)
 	if err != nil {
 		return err
 	}
-	if err := SaveKey(realID, key); err != nil {
+	if err := ks.SaveKey(realID, key); err != nil {
 		return err
 	}
-	return DeleteKey(tempID)
+	return ks.DeleteKey(tempID)
 }
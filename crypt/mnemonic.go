@@ -0,0 +1,110 @@
+package crypt
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The standard BIP39 English word list, 2048 words.
+//
+//go:embed bip39_english.txt
+var bip39English string
+
+var (
+	wordList  = strings.Fields(bip39English)
+	wordIndex = func() map[string]int {
+		index := make(map[string]int, len(wordList))
+		for i, w := range wordList {
+			index[w] = i
+		}
+		return index
+	}()
+)
+
+// MnemonicWords is the length of a recovery phrase for a 32-byte seed:
+// 256 bits of seed plus an 8 bit checksum, 11 bits per word.
+const MnemonicWords = 24
+
+var ErrMnemonicChecksum = errors.New("recovery phrase checksum does not match, check the words and their order")
+
+// SeedToMnemonic encodes an Ed25519 seed as a BIP39-style recovery phrase.
+// The seed is used directly as the BIP39 entropy, so the phrase restores
+// the exact same key pair rather than deriving a new one from it.
+func SeedToMnemonic(seed []byte) ([]string, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("seed must be 32 bytes")
+	}
+
+	checksum := sha256.Sum256(seed)
+	bits := append(append([]byte{}, seed...), checksum[0])
+
+	words := make([]string, MnemonicWords)
+	for i := range words {
+		words[i] = wordList[readBits(bits, i*11, 11)]
+	}
+	return words, nil
+}
+
+// MnemonicToSeed decodes a recovery phrase back into the seed and checks
+// its checksum. Case and extra whitespace are ignored.
+func MnemonicToSeed(phrase string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(phrase))
+	if len(words) != MnemonicWords {
+		return nil, fmt.Errorf("recovery phrase must have %d words, got %d", MnemonicWords, len(words))
+	}
+
+	bits := make([]byte, ed25519.SeedSize+1)
+	for i, w := range words {
+		index, ok := wordIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("word %d (%q) is not in the word list", i+1, w)
+		}
+		writeBits(bits, i*11, 11, index)
+	}
+
+	seed := bits[:ed25519.SeedSize]
+	checksum := sha256.Sum256(seed)
+	if checksum[0] != bits[ed25519.SeedSize] {
+		return nil, ErrMnemonicChecksum
+	}
+	return seed, nil
+}
+
+// IdentityFromMnemonic restores a key pair from its recovery phrase.
+func IdentityFromMnemonic(phrase string) (*Identity, error) {
+	seed, err := MnemonicToSeed(phrase)
+	if err != nil {
+		return nil, err
+	}
+	return identityFromPrivateKey(ed25519.NewKeyFromSeed(seed))
+}
+
+// LooksLikeMnemonic tells a typed recovery phrase apart from a file path.
+func LooksLikeMnemonic(input string) bool {
+	return len(strings.Fields(input)) >= MnemonicWords/2
+}
+
+func readBits(data []byte, offset, n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit := offset + i
+		v <<= 1
+		if data[bit/8]&(0x80>>(bit%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+func writeBits(data []byte, offset, n, v int) {
+	for i := 0; i < n; i++ {
+		bit := offset + i
+		if v&(1<<(n-1-i)) != 0 {
+			data[bit/8] |= 0x80 >> (bit % 8)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 256-bit vectors from the BIP39 reference test set (trezor/python-mnemonic)
+var bip39Vectors = []struct {
+	entropy string
+	phrase  string
+}{
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title",
+	},
+	{
+		"8080808080808080808080808080808080808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic bless",
+	},
+	{
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+	},
+	{
+		"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c",
+		"hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length",
+	},
+	{
+		"9f6a2878b2520799a44ef18bc7df394e7061a224d2c33cd015b157d746869863",
+		"panda eyebrow bullet gorilla call smoke muffin taste mesh discover soft ostrich alcohol speed nation flash devote level hobby quick inner drive ghost inside",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for _, v := range bip39Vectors {
+		seed, _ := hex.DecodeString(v.entropy)
+
+		words, err := SeedToMnemonic(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(words, " "); got != v.phrase {
+			t.Errorf("SeedToMnemonic(%s) = %q, want %q", v.entropy, got, v.phrase)
+		}
+
+		back, err := MnemonicToSeed("  " + strings.ToUpper(v.phrase) + "\n")
+		if err != nil {
+			t.Errorf("MnemonicToSeed(%q): %v", v.phrase, err)
+		} else if !bytes.Equal(back, seed) {
+			t.Errorf("MnemonicToSeed(%q) = %x, want %s", v.phrase, back, v.entropy)
+		}
+	}
+}
+
+func TestMnemonicRejects(t *testing.T) {
+	valid := strings.Fields(bip39Vectors[4].phrase)
+
+	// the last word carries the checksum, any other last word breaks it
+	badChecksum := append([]string{}, valid...)
+	badChecksum[len(badChecksum)-1] = "abandon"
+	if _, err := MnemonicToSeed(strings.Join(badChecksum, " ")); !errors.Is(err, ErrMnemonicChecksum) {
+		t.Errorf("bad checksum: err = %v, want ErrMnemonicChecksum", err)
+	}
+
+	// two words swapped keep every word valid but move the bits around
+	swapped := append([]string{}, valid...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	if _, err := MnemonicToSeed(strings.Join(swapped, " ")); !errors.Is(err, ErrMnemonicChecksum) {
+		t.Errorf("swapped words: err = %v, want ErrMnemonicChecksum", err)
+	}
+
+	for name, phrase := range map[string]string{
+		"too short":    strings.Join(valid[:23], " "),
+		"unknown word": strings.Join(append([]string{"dropkey"}, valid[1:]...), " "),
+	} {
+		if _, err := MnemonicToSeed(phrase); err == nil || errors.Is(err, ErrMnemonicChecksum) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
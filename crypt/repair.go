@@ -0,0 +1,67 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// RecoverOrphans puts back the keys of pastes whose upload was interrupted
+// between the server accepting the paste and the key being moved from its
+// temporary ID to the paste ID.
+//
+// ciphertexts maps paste IDs to their base64 ciphertext. Every paste in it
+// without a key is tried against the stored keys that do not belong to
+// any listed paste, and AES-GCM only opens under the key it was sealed
+// with, so a match is never a guess. Matched keys are moved to the paste
+// ID and the moves are returned as temp ID to paste ID.
+func RecoverOrphans(ks KeyStore, ciphertexts map[string]string) (map[string]string, error) {
+	ids, err := ks.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paste keys: %w", err)
+	}
+
+	var orphans []string
+	for _, id := range ids {
+		if _, listed := ciphertexts[id]; !listed {
+			orphans = append(orphans, id)
+		}
+	}
+	return RecoverKeys(ks, orphans, ciphertexts)
+}
+
+// RecoverKeys is RecoverOrphans for a caller that already knows which keys
+// are orphans, e.g. because it walks the list a page at a time and
+// ciphertexts only holds one page.
+func RecoverKeys(ks KeyStore, orphans []string, ciphertexts map[string]string) (map[string]string, error) {
+	orphans = append([]string(nil), orphans...)
+	moved := map[string]string{}
+	for pasteID, ctB64 := range ciphertexts {
+		if len(orphans) == 0 {
+			break
+		}
+		if _, err := ks.GetKey(pasteID); err == nil {
+			continue
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(ctB64)
+		if err != nil || len(ciphertext) == 0 {
+			continue
+		}
+
+		for i, tempID := range orphans {
+			key, err := ks.GetKey(tempID)
+			if err != nil {
+				continue
+			}
+			if _, err := openWithKey(key, ciphertext); err != nil {
+				continue
+			}
+			if err := MoveKey(ks, tempID, pasteID); err != nil {
+				return moved, fmt.Errorf("failed to move key %s to %s: %w", tempID, pasteID, err)
+			}
+			moved[tempID] = pasteID
+			orphans = append(orphans[:i], orphans[i+1:]...)
+			break
+		}
+	}
+	return moved, nil
+}
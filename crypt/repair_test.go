@@ -0,0 +1,49 @@
+package crypt
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestRecoverOrphans(t *testing.T) {
+	for name, ks := range map[string]KeyStore{
+		"memory": NewMemoryKeyStore(),
+		"fs":     FSKeyStore{Dir: t.TempDir()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// the upload was accepted as "paste-1" but the key is still
+			// under the temp ID
+			ct, err := EncryptPaste(ks, "temp-1", []byte("interrupted"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := GenerateKey(ks, "temp-2"); err != nil {
+				t.Fatal(err)
+			}
+			other, err := EncryptPaste(ks, "paste-2", []byte("fine"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			moved, err := RecoverOrphans(ks, map[string]string{
+				"paste-1": base64.StdEncoding.EncodeToString(ct),
+				"paste-2": base64.StdEncoding.EncodeToString(other),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(moved) != 1 || moved["temp-1"] != "paste-1" {
+				t.Fatalf("moved = %v", moved)
+			}
+
+			plain, err := open(ks, "paste-1", ct)
+			if err != nil || string(plain) != "interrupted" {
+				t.Fatalf("open after repair = %q, %v", plain, err)
+			}
+			ids, _ := ks.ListKeys()
+			if len(ids) != 3 {
+				t.Fatalf("keys = %v, want paste-1, paste-2 and the unmatched temp-2", ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package crypt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// rotationDomain separates key rotation statements from every other kind
+// of message signed with an identity key.
+const rotationDomain = "DropKey-Rotate-v1\x00"
+
+// RotationStatement is signed by the old identity key to endorse the new
+// one, and by the new key to prove it is held by the same person.
+type RotationStatement struct {
+	UserID       string    `json:"user_id"`
+	OldPublicKey string    `json:"old_public_key"`
+	NewPublicKey string    `json:"new_public_key"`
+	RotatedAt    time.Time `json:"rotated_at"`
+}
+
+// Message returns the exact bytes both keys sign.
+func (s RotationStatement) Message() []byte {
+	return []byte(rotationDomain +
+		s.UserID + "\x00" +
+		s.OldPublicKey + "\x00" +
+		s.NewPublicKey + "\x00" +
+		s.RotatedAt.UTC().Format(time.RFC3339))
+}
+
+// Sign signs the statement with a base64 private key and returns the
+// base64 signature.
+func (s RotationStatement) Sign(privateKeyB64 string) (string, error) {
+	priv, err := base64.StdEncoding.DecodeString(privateKeyB64)
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return "", errors.New("invalid private key")
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, s.Message())), nil
+}
+
+// Verify checks that the old key endorsed the new one and that the new key
+// signed the same statement.
+func (s RotationStatement) Verify(oldSignatureB64, newSignatureB64 string) bool {
+	return verify(s.Message(), oldSignatureB64, s.OldPublicKey) == Verified &&
+		verify(s.Message(), newSignatureB64, s.NewPublicKey) == Verified
+}
@@ -0,0 +1,305 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Streamed pastes are encrypted in fixed-size chunks so neither side has
+// to hold the whole paste in memory. The layout is
+//
+//	magic "DKSTRM" | version | chunk size (uint32) | nonce prefix (7 bytes)
+//	chunk 0 | chunk 1 | ... | final chunk
+//
+// Every chunk is sealed with AES-256-GCM under the per-paste key. The
+// 12-byte nonce is the random prefix, a big-endian chunk counter and a
+// final-chunk flag, and the header is the additional data of every chunk.
+// Reordering, dropping or appending chunks and truncating the stream all
+// fail authentication.
+const (
+	StreamChunkSize = 64 << 10
+
+	streamVersion    = 1
+	streamPrefixSize = 7
+	streamHeaderSize = len(streamMagic) + 1 + 4 + streamPrefixSize
+	maxStreamChunk   = 1 << 20
+)
+
+var streamMagic = [...]byte{'D', 'K', 'S', 'T', 'R', 'M'}
+
+var ErrStreamTruncated = errors.New("encrypted stream is truncated or was tampered with")
+
+// streamSignOpts selects Ed25519ph, which signs a SHA-512 digest, so the
+// signature over a streamed ciphertext can be computed without buffering
+// it. The context keeps these signatures apart from plain paste ones.
+var streamSignOpts = &ed25519.Options{Hash: crypto.SHA512, Context: "DropKey-Stream-v1"}
+
+// IsStream reports whether data starts with a streamed paste header.
+func IsStream(data []byte) bool {
+	return bytes.HasPrefix(data, streamMagic[:])
+}
+
+// NewStreamEncrypter generates and stores a key for id and returns a
+// writer that encrypts into w. Close must be called to write the final
+// chunk, it does not close w.
+func NewStreamEncrypter(ks KeyStore, id string, w io.Writer) (io.WriteCloser, error) {
+	key, err := GenerateKey(ks, id)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamWriter(key, w)
+}
+
+// NewStreamDecrypter reads the stream header from r and returns a reader
+// of the plaintext, using the stored key for id. The reader returns
+// ErrStreamTruncated if r ends before the final chunk.
+func NewStreamDecrypter(ks KeyStore, id string, r io.Reader) (io.Reader, error) {
+	key, err := ks.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(key, r)
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key length: must be 32 bytes for AES-256")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func streamNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+type streamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	out     []byte
+	counter uint32
+	started bool
+	closed  bool
+}
+
+func newStreamWriter(key []byte, w io.Writer) (*streamWriter, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, streamHeaderSize)
+	header = append(header, streamMagic[:]...)
+	header = append(header, streamVersion)
+	header = binary.BigEndian.AppendUint32(header, StreamChunkSize)
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+
+	return &streamWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, StreamChunkSize),
+		out:    make([]byte, 0, StreamChunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write buffers one chunk and only seals it once more data arrives, so
+// the last chunk can be sealed as final on Close.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed stream")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(s.buf) == StreamChunkSize {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(s.buf[len(s.buf):StreamChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+func (s *streamWriter) flush(final bool) error {
+	if !s.started {
+		if _, err := s.w.Write(s.header); err != nil {
+			return err
+		}
+		s.started = true
+	}
+	if s.counter == math.MaxUint32 {
+		return errors.New("stream is too long")
+	}
+
+	prefix := s.header[streamHeaderSize-streamPrefixSize:]
+	s.out = s.aead.Seal(s.out[:0], streamNonce(prefix, s.counter, final), s.buf, s.header)
+	s.counter++
+	s.buf = s.buf[:0]
+
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+type streamReader struct {
+	r         *bufio.Reader
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+	chunk     []byte
+	plain     []byte
+	counter   uint32
+	done      bool
+}
+
+func newStreamReader(key []byte, r io.Reader) (*streamReader, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrStreamTruncated
+	}
+	if !IsStream(header) {
+		return nil, errors.New("not an encrypted stream")
+	}
+	if v := header[len(streamMagic)]; v != streamVersion {
+		return nil, fmt.Errorf("unsupported stream version %d", v)
+	}
+	chunkSize := int(binary.BigEndian.Uint32(header[len(streamMagic)+1:]))
+	if chunkSize == 0 || chunkSize > maxStreamChunk {
+		return nil, fmt.Errorf("invalid stream chunk size %d", chunkSize)
+	}
+
+	sealed := chunkSize + aead.Overhead()
+	return &streamReader{
+		r:         bufio.NewReaderSize(r, sealed+1),
+		aead:      aead,
+		header:    header,
+		chunkSize: chunkSize,
+		chunk:     make([]byte, sealed),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next opens the following chunk. A short read, or a full chunk with
+// nothing after it, is the final chunk and must carry the final flag.
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	final := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		final = true
+	case err != nil:
+		return err
+	default:
+		if _, perr := s.r.Peek(1); perr == io.EOF {
+			final = true
+		}
+	}
+	if n < s.aead.Overhead() {
+		return ErrStreamTruncated
+	}
+
+	prefix := s.header[streamHeaderSize-streamPrefixSize:]
+	plain, err := s.aead.Open(s.chunk[:0], streamNonce(prefix, s.counter, final), s.chunk[:n], s.header)
+	if err != nil {
+		return ErrStreamTruncated
+	}
+	s.counter++
+	s.plain = plain
+	s.done = final
+	return nil
+}
+
+// SignStreamDigest signs the SHA-512 digest of a streamed ciphertext with
+// the base64 Ed25519 private key.
+func SignStreamDigest(privateKeyB64 string, digest []byte) (string, error) {
+	privKey, err := base64.StdEncoding.DecodeString(privateKeyB64)
+	if err != nil || len(privKey) != ed25519.PrivateKeySize {
+		return "", errors.New("configured private key is invalid")
+	}
+	sig, err := ed25519.PrivateKey(privKey).Sign(nil, digest, streamSignOpts)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyStreamDigest checks a signature made by SignStreamDigest. known
+// has the same meaning as in VerifyAndOpen.
+func VerifyStreamDigest(digest []byte, signatureB64, publicKeyB64 string, known func(publicKeyB64 string) bool) TrustStatus {
+	if signatureB64 == "" || publicKeyB64 == "" {
+		return Unsigned
+	}
+
+	pubKey, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return BadSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return BadSignature
+	}
+	if ed25519.VerifyWithOptions(pubKey, digest, signature, streamSignOpts) != nil {
+		return BadSignature
+	}
+
+	if known != nil && !known(publicKeyB64) {
+		return UnknownSigner
+	}
+	return Verified
+}
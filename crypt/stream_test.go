@@ -0,0 +1,146 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func streamKey() []byte {
+	return bytes.Repeat([]byte{3}, 32)
+}
+
+func sealStream(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := newStreamWriter(streamKey(), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func openStream(data []byte) ([]byte, error) {
+	r, err := newStreamReader(streamKey(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// chunks splits a sealed stream into its header and sealed chunks
+func chunks(data []byte) (header []byte, sealed [][]byte) {
+	header, data = data[:streamHeaderSize], data[streamHeaderSize:]
+	size := StreamChunkSize + 16
+	for len(data) > size {
+		sealed = append(sealed, data[:size])
+		data = data[size:]
+	}
+	return header, append(sealed, data)
+}
+
+func join(header []byte, sealed ...[]byte) []byte {
+	return bytes.Join(append([][]byte{header}, sealed...), nil)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, StreamChunkSize, StreamChunkSize + 1, 2*StreamChunkSize + StreamChunkSize/2} {
+		plain := make([]byte, size)
+		for i := range plain {
+			plain[i] = byte(i * 7)
+		}
+		got, err := openStream(sealStream(t, plain))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("%d bytes: plaintext differs", size)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	plain := bytes.Repeat([]byte("drop key "), StreamChunkSize*3/9)
+	data := sealStream(t, plain)
+	header, sealed := chunks(data)
+	if len(sealed) != 3 {
+		t.Fatalf("test stream has %d chunks, want 3", len(sealed))
+	}
+
+	flip := func(b []byte, i int) []byte {
+		b = bytes.Clone(b)
+		b[i] ^= 1
+		return b
+	}
+
+	// a stream whose first full chunk claims to be the last one
+	var early bytes.Buffer
+	w, err := newStreamWriter(streamKey(), &early)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.buf = append(w.buf, plain[:StreamChunkSize]...)
+	if err := w.flush(true); err != nil {
+		t.Fatal(err)
+	}
+	w.buf = append(w.buf, "more"...)
+	if err := w.flush(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stream that ends without a chunk sealed as final
+	var unfinished bytes.Buffer
+	w, err = newStreamWriter(streamKey(), &unfinished)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.buf = append(w.buf, "the end?"...)
+	if err := w.flush(false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		"header only":         header,
+		"short header":        data[:streamHeaderSize-1],
+		"last chunk dropped":  join(header, sealed[0], sealed[1]),
+		"cut inside a chunk":  data[:len(data)-len(sealed[2])/2],
+		"cut to a tag":        join(header, sealed[0], sealed[1][:10]),
+		"chunks reordered":    join(header, sealed[1], sealed[0], sealed[2]),
+		"chunk duplicated":    join(header, sealed[0], sealed[0], sealed[1], sealed[2]),
+		"chunk appended":      join(header, sealed[0], sealed[1], sealed[2], sealed[2]),
+		"missing final flag":  unfinished.Bytes(),
+		"early final flag":    early.Bytes(),
+		"nonce prefix":        join(flip(header, streamHeaderSize-1), sealed...),
+		"chunk size":          join(flip(header, len(streamMagic)+4), sealed...),
+		"chunk body":          join(header, sealed[0], flip(sealed[1], 100), sealed[2]),
+		"header from another": join(sealStream(t, nil)[:streamHeaderSize], sealed...),
+	}
+	for name, data := range tests {
+		got, err := openStream(data)
+		if err == nil {
+			t.Errorf("%s: opened %d bytes", name, len(got))
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"magic":   join(flip(header, 0), sealed...),
+		"version": join(flip(header, len(streamMagic)), sealed...),
+	} {
+		if _, err := openStream(data); err == nil || errors.Is(err, ErrStreamTruncated) {
+			t.Errorf("%s: err = %v, want a format error", name, err)
+		}
+	}
+
+	for _, name := range []string{"last chunk dropped", "chunks reordered", "chunk duplicated", "missing final flag", "early final flag", "nonce prefix"} {
+		if _, err := openStream(tests[name]); !errors.Is(err, ErrStreamTruncated) {
+			t.Errorf("%s: err = %v, want ErrStreamTruncated", name, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// titleKeyLabel derives the title key from the paste key, so the small
+// title header never shares a key, and with it a nonce space, with the
+// body or the chunks of a streamed paste.
+const titleKeyLabel = "DropKey-Title-v1"
+
+// titleSignOpts selects Ed25519ctx, so a title signature can never pass
+// for the signature of a paste or a stream
+var titleSignOpts = &ed25519.Options{Context: "DropKey-Title-v1"}
+
+func titleAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("invalid key length: must be 32 bytes for AES-256")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(titleKeyLabel))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealTitle encrypts header under a key derived from the paste key stored
+// for id and returns it base64 encoded. It lets a paste list show titles
+// without decrypting whole pastes.
+func SealTitle(ks KeyStore, id string, header []byte) (string, error) {
+	key, err := ks.GetKey(id)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := titleAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, header, nil)), nil
+}
+
+// OpenTitle decrypts a header sealed with SealTitle.
+func OpenTitle(ks KeyStore, id, headerB64 string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(headerB64)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ks.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := titleAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("title header too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// SignTitle signs a header sealed with SealTitle with the base64 Ed25519
+// private key. The paste signature only covers the ciphertext, this one
+// lets a list trust the title without decrypting the body.
+func SignTitle(privateKeyB64, headerB64 string) (string, error) {
+	privKey, err := base64.StdEncoding.DecodeString(privateKeyB64)
+	if err != nil || len(privKey) != ed25519.PrivateKeySize {
+		return "", errors.New("configured private key is invalid")
+	}
+	header, err := base64.StdEncoding.DecodeString(headerB64)
+	if err != nil {
+		return "", err
+	}
+	sig, err := ed25519.PrivateKey(privKey).Sign(nil, header, titleSignOpts)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyTitle checks a signature made by SignTitle. known has the same
+// meaning as in VerifyAndOpen.
+func VerifyTitle(headerB64, signatureB64, publicKeyB64 string, known func(publicKeyB64 string) bool) TrustStatus {
+	if signatureB64 == "" || publicKeyB64 == "" {
+		return Unsigned
+	}
+
+	pubKey, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return BadSignature
+	}
+	header, err := base64.StdEncoding.DecodeString(headerB64)
+	if err != nil {
+		return BadSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return BadSignature
+	}
+	if ed25519.VerifyWithOptions(pubKey, header, signature, titleSignOpts) != nil {
+		return BadSignature
+	}
+
+	if known != nil && !known(publicKeyB64) {
+		return UnknownSigner
+	}
+	return Verified
+}
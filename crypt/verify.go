@@ -0,0 +1,113 @@
+package crypt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+)
+
+// TrustStatus describes what the signature on a paste tells us about who
+// wrote it.
+type TrustStatus int
+
+const (
+	// Verified means the signature is valid and the signer is known.
+	Verified TrustStatus = iota
+	// Unsigned means the paste carries no signature or public key.
+	Unsigned
+	// BadSignature means the signature does not match the ciphertext.
+	BadSignature
+	// UnknownSigner means the signature is valid but the key is not known.
+	UnknownSigner
+)
+
+func (s TrustStatus) String() string {
+	switch s {
+	case Verified:
+		return "verified"
+	case Unsigned:
+		return "unsigned"
+	case BadSignature:
+		return "bad signature"
+	case UnknownSigner:
+		return "unknown signer"
+	}
+	return "unknown"
+}
+
+// Opened is the result of verifying and decrypting a paste.
+type Opened struct {
+	Plaintext   []byte
+	Status      TrustStatus
+	Signer      string
+	Fingerprint string
+}
+
+// VerifyAndOpen checks the Ed25519 signature over the raw ciphertext and
+// decrypts it with the stored key for id. known decides whether a valid
+// signer is one the user trusts, it may be nil.
+//
+// A bad signature is not an error: the result carries BadSignature and no
+// plaintext, so callers can show why the paste was not opened. Errors are
+// only returned when decryption itself fails.
+func VerifyAndOpen(ks KeyStore, id, ciphertextB64, signatureB64, publicKeyB64 string, known func(publicKeyB64 string) bool) (*Opened, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext encoding: %w", err)
+	}
+
+	result := &Opened{
+		Status:      trustStatus(ciphertext, signatureB64, publicKeyB64, known),
+		Signer:      publicKeyB64,
+		Fingerprint: Fingerprint(publicKeyB64),
+	}
+	if result.Status == BadSignature {
+		return result, nil
+	}
+
+	plaintext, err := open(ks, id, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	result.Plaintext = plaintext
+
+	return result, nil
+}
+
+// Verify is the signature check of VerifyAndOpen on its own, for lists
+// that show the trust status of pastes without decrypting them.
+func Verify(ciphertextB64, signatureB64, publicKeyB64 string, known func(publicKeyB64 string) bool) TrustStatus {
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return BadSignature
+	}
+	return trustStatus(ciphertext, signatureB64, publicKeyB64, known)
+}
+
+func trustStatus(ciphertext []byte, signatureB64, publicKeyB64 string, known func(publicKeyB64 string) bool) TrustStatus {
+	if signatureB64 == "" || publicKeyB64 == "" {
+		return Unsigned
+	}
+	status := verify(ciphertext, signatureB64, publicKeyB64)
+	if status == Verified && known != nil && !known(publicKeyB64) {
+		return UnknownSigner
+	}
+	return status
+}
+
+func verify(message []byte, signatureB64, publicKeyB64 string) TrustStatus {
+	pubKey, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return BadSignature
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return BadSignature
+	}
+
+	if !ed25519.Verify(pubKey, message, signature) {
+		return BadSignature
+	}
+	return Verified
+}
@@ -0,0 +1,605 @@
+// Package devserver is an in-memory DropKey backend for tests and offline
+// development. It speaks the same API as the real server and checks what
+// the real server checks, challenge signatures, paste signatures, expiry
+// and ID formats, but forgets everything when it stops.
+//
+//	srv := httptest.NewServer(devserver.New())
+//	api.SetBackendURL(srv.URL)
+package devserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/crypt"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ChallengeLifetime is how long a login nonce can be answered
+	ChallengeLifetime = time.Minute
+	// TokenLifetime is how long a bearer token is accepted
+	TokenLifetime = 15 * time.Minute
+	// MaxExpiry is the longest a paste may live, in seconds
+	MaxExpiry = 7 * 86400
+	// MaxPageSize caps the limit of a paste list page
+	MaxPageSize = 100
+
+	// maxPasteBody bounds JSON paste requests, streamed pastes have no limit
+	maxPasteBody = 48 << 20
+)
+
+// Server is an http.Handler serving the DropKey API from memory. The zero
+// value is not usable, call New.
+type Server struct {
+	// Now is the server clock. Tests can replace it to expire challenges,
+	// tokens and pastes without waiting.
+	Now func() time.Time
+
+	mux *http.ServeMux
+
+	mu         sync.Mutex
+	users      map[string]*user
+	byKey      map[string]string // any current or retired public key -> user ID
+	challenges map[string]*challenge
+	tokens     map[string]session
+	pastes     map[string]*storedPaste
+	// created maps the Idempotency-Key of a create, per user, to the
+	// paste it made
+	created map[string]string
+}
+
+type user struct {
+	id        string
+	publicKey string
+	rotations []api.KeyRotation
+}
+
+type challenge struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+type session struct {
+	userID    string
+	expiresAt time.Time
+}
+
+type storedPaste struct {
+	api.Paste
+	userID    string
+	createdAt time.Time
+	// raw holds the ciphertext of streamed pastes
+	raw []byte
+}
+
+func New() *Server {
+	s := &Server{
+		Now:        time.Now,
+		mux:        http.NewServeMux(),
+		users:      map[string]*user{},
+		byKey:      map[string]string{},
+		challenges: map[string]*challenge{},
+		tokens:     map[string]session{},
+		pastes:     map[string]*storedPaste{},
+		created:    map[string]string{},
+	}
+
+	s.mux.HandleFunc("POST /api/users", s.register)
+	s.mux.HandleFunc("POST /api/users/challenge", s.challenge)
+	s.mux.HandleFunc("POST /api/users/auth", s.auth)
+	s.mux.HandleFunc("POST /api/users/rotate", s.authenticated(s.rotate))
+	s.mux.HandleFunc("GET /api/users/keys", s.keyHistory)
+	s.mux.HandleFunc("POST /api/pastes", s.authenticated(s.createPaste))
+	s.mux.HandleFunc("POST /api/pastes/stream", s.authenticated(s.createStreamPaste))
+	s.mux.HandleFunc("GET /api/pastes", s.listPastes)
+	s.mux.HandleFunc("GET /api/pastes/{id}", s.getPaste)
+	s.mux.HandleFunc("GET /api/pastes/{id}/raw", s.getRawPaste)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// PasteCount returns how many pastes are stored, expired ones included.
+func (s *Server) PasteCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pastes)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, api.ErrorResponse{Message: message, Code: code})
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasteBody)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "", "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func decodePublicKey(b64 string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("public key must be a base64 Ed25519 key")
+	}
+	return key, nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req api.RegisterUserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if _, err := decodePublicKey(req.PublicKey); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byKey[req.PublicKey]; ok {
+		writeError(w, http.StatusConflict, "", "public key is already registered")
+		return
+	}
+	u := &user{id: uuid.New().String(), publicKey: req.PublicKey}
+	s.users[u.id] = u
+	s.byKey[req.PublicKey] = u.id
+	writeJSON(w, http.StatusCreated, api.RegisterUserResponse{ID: u.id})
+}
+
+func (s *Server) challenge(w http.ResponseWriter, r *http.Request) {
+	var req api.ChallengeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[req.ID]; !ok {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	nonce := randomToken()
+	expiresAt := s.Now().Add(ChallengeLifetime)
+	s.challenges[nonce] = &challenge{userID: req.ID, expiresAt: expiresAt}
+	writeJSON(w, http.StatusOK, api.ChallengeResponse{Nonce: nonce, ExpiresAt: expiresAt})
+}
+
+func (s *Server) auth(w http.ResponseWriter, r *http.Request) {
+	var req api.AuthRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[req.Challenge]
+	switch {
+	case !ok || c.userID != req.ID:
+		writeError(w, http.StatusUnauthorized, "nonce_invalid", "unknown challenge")
+		return
+	case c.used:
+		writeError(w, http.StatusUnauthorized, "nonce_reused", "challenge was already answered")
+		return
+	case s.Now().After(c.expiresAt):
+		writeError(w, http.StatusUnauthorized, "nonce_expired", "challenge expired")
+		return
+	}
+	c.used = true
+
+	u := s.users[req.ID]
+	pubKey, _ := decodePublicKey(u.publicKey)
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil || !ed25519.Verify(pubKey, api.ChallengeMessage(req.ID, req.Challenge), signature) {
+		writeError(w, http.StatusUnauthorized, "invalid_signature", "signature does not match the registered key")
+		return
+	}
+
+	token := randomToken()
+	expiresAt := s.Now().Add(TokenLifetime)
+	s.tokens[token] = session{userID: u.id, expiresAt: expiresAt}
+	writeJSON(w, http.StatusOK, api.AuthResponse{Message: "authenticated", Token: token, ExpiresAt: expiresAt})
+}
+
+// authenticated rejects requests without a live bearer token and passes
+// the user ID on to next
+func (s *Server) authenticated(next func(w http.ResponseWriter, r *http.Request, userID string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		sess, found := s.tokens[token]
+		s.mu.Unlock()
+		if !ok || !found || s.Now().After(sess.expiresAt) {
+			writeError(w, http.StatusUnauthorized, "", "missing or expired token")
+			return
+		}
+		next(w, r, sess.userID)
+	}
+}
+
+func (s *Server) rotate(w http.ResponseWriter, r *http.Request, userID string) {
+	var rotation api.KeyRotation
+	if !decodeJSON(w, r, &rotation) {
+		return
+	}
+	if rotation.UserID != userID {
+		writeError(w, http.StatusForbidden, "", "rotation is for another account")
+		return
+	}
+	if !rotation.Valid() {
+		writeError(w, http.StatusBadRequest, "invalid_signature", "rotation must be signed by the old and the new key")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[userID]
+	if rotation.OldPublicKey != u.publicKey {
+		writeError(w, http.StatusConflict, "", "old public key is not the current key")
+		return
+	}
+	if owner, ok := s.byKey[rotation.NewPublicKey]; ok && owner != userID {
+		writeError(w, http.StatusConflict, "", "new public key belongs to another account")
+		return
+	}
+	u.publicKey = rotation.NewPublicKey
+	u.rotations = append(u.rotations, rotation)
+	s.byKey[rotation.NewPublicKey] = userID
+	writeJSON(w, http.StatusOK, rotation)
+}
+
+func (s *Server) keyHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID, ok := s.byKey[r.URL.Query().Get("public_key")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "unknown public key")
+		return
+	}
+	rotations := s.users[userID].rotations
+	if rotations == nil {
+		rotations = []api.KeyRotation{}
+	}
+	writeJSON(w, http.StatusOK, rotations)
+}
+
+// checkOwner makes sure the paste is signed with the caller's current key
+func (s *Server) checkOwner(userID, publicKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users[userID].publicKey != publicKey {
+		return errors.New("public key is not the current key of this account")
+	}
+	return nil
+}
+
+// validTitle checks the signature of a title header, pastes without one
+// are fine
+func validTitle(header, signature, publicKey string) bool {
+	return header == "" || crypt.VerifyTitle(header, signature, publicKey, nil) == crypt.Verified
+}
+
+func validExpiry(expiresIn int) error {
+	if expiresIn <= 0 || expiresIn > MaxExpiry {
+		return fmt.Errorf("expires_in must be between 1 and %d seconds", MaxExpiry)
+	}
+	return nil
+}
+
+func (s *Server) createPaste(w http.ResponseWriter, r *http.Request, userID string) {
+	var req api.PasteRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := validExpiry(req.ExpiresIn); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	pubKey, err := decodePublicKey(req.PublicKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	if err := s.checkOwner(userID, req.PublicKey); err != nil {
+		writeError(w, http.StatusForbidden, "", err.Error())
+		return
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(req.Ciphertext)
+	if err != nil || len(ciphertext) == 0 {
+		writeError(w, http.StatusBadRequest, "", "ciphertext must be non-empty base64")
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil || !ed25519.Verify(pubKey, ciphertext, signature) {
+		writeError(w, http.StatusBadRequest, "invalid_signature", "signature does not match the ciphertext")
+		return
+	}
+	if !validTitle(req.TitleHeader, req.TitleSignature, req.PublicKey) {
+		writeError(w, http.StatusBadRequest, "invalid_signature", "title signature does not match the title header")
+		return
+	}
+
+	s.store(w, r, &storedPaste{
+		Paste: api.Paste{
+			Ciphertext:     req.Ciphertext,
+			Signature:      req.Signature,
+			PublicKey:      req.PublicKey,
+			TitleHeader:    req.TitleHeader,
+			TitleSignature: req.TitleSignature,
+		},
+		userID: userID,
+	}, req.ExpiresIn)
+}
+
+// createStreamPaste reads the multipart form in the order the client
+// writes it, so the signature arrives after the ciphertext it covers
+func (s *Server) createStreamPaste(w http.ResponseWriter, r *http.Request, userID string) {
+	form, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", "expected a multipart form")
+		return
+	}
+
+	fields := map[string]string{}
+	var ciphertext []byte
+	digest := sha512.New()
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "", "invalid multipart form: "+err.Error())
+			return
+		}
+		if part.FormName() == "ciphertext" {
+			ciphertext, err = io.ReadAll(io.TeeReader(part, digest))
+		} else {
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, 4096))
+			fields[part.FormName()] = string(value)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "", "failed to read upload: "+err.Error())
+			return
+		}
+	}
+
+	expiresIn, err := strconv.Atoi(fields["expires_in"])
+	if err == nil {
+		err = validExpiry(expiresIn)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "", "invalid expires_in")
+		return
+	}
+	if _, err := decodePublicKey(fields["public_key"]); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+	if err := s.checkOwner(userID, fields["public_key"]); err != nil {
+		writeError(w, http.StatusForbidden, "", err.Error())
+		return
+	}
+	if !crypt.IsStream(ciphertext) {
+		writeError(w, http.StatusBadRequest, "", "ciphertext is not a DropKey stream")
+		return
+	}
+	if crypt.VerifyStreamDigest(digest.Sum(nil), fields["signature"], fields["public_key"], nil) != crypt.Verified {
+		writeError(w, http.StatusBadRequest, "invalid_signature", "signature does not match the ciphertext")
+		return
+	}
+	if !validTitle(fields["title_header"], fields["title_signature"], fields["public_key"]) {
+		writeError(w, http.StatusBadRequest, "invalid_signature", "title signature does not match the title header")
+		return
+	}
+
+	s.store(w, r, &storedPaste{
+		Paste: api.Paste{
+			Signature:      fields["signature"],
+			PublicKey:      fields["public_key"],
+			Streamed:       true,
+			TitleHeader:    fields["title_header"],
+			TitleSignature: fields["title_signature"],
+		},
+		userID: userID,
+		raw:    ciphertext,
+	}, expiresIn)
+}
+
+// store saves a new paste. A create repeated with the same Idempotency-Key
+// answers with the paste the first one made.
+func (s *Server) store(w http.ResponseWriter, r *http.Request, p *storedPaste, expiresIn int) {
+	now := s.Now()
+	p.ID = uuid.New().String()
+	p.createdAt = now
+	p.ExpiresAt = now.Add(time.Duration(expiresIn) * time.Second)
+
+	s.mu.Lock()
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		key = p.userID + "\x00" + key
+		if id, ok := s.created[key]; ok {
+			p = s.pastes[id]
+		} else {
+			s.created[key] = p.ID
+		}
+	}
+	s.pastes[p.ID] = p
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, api.CreatePasteResponse{
+		ID:  p.ID,
+		URL: fmt.Sprintf("http://%s/pastes/%s", r.Host, p.ID),
+	})
+}
+
+func (s *Server) listPastes(w http.ResponseWriter, r *http.Request) {
+	publicKey := r.URL.Query().Get("public_key")
+	if _, err := decodePublicKey(publicKey); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	now := s.Now()
+	var found []*storedPaste
+	for _, p := range s.pastes {
+		if p.PublicKey == publicKey && now.Before(p.ExpiresAt) {
+			found = append(found, p)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(found, func(i, j int) bool { return newerThan(found[i], found[j]) })
+
+	// clients that predate pagination ask without a limit and get the
+	// bare array they expect
+	query := r.URL.Query()
+	if !query.Has("limit") && !query.Has("cursor") {
+		writeJSON(w, http.StatusOK, pasteList(found))
+		return
+	}
+
+	limit := MaxPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "", "limit must be a positive number")
+			return
+		}
+		limit = min(n, MaxPageSize)
+	}
+
+	start := 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "", "invalid cursor")
+			return
+		}
+		start = sort.Search(len(found), func(i int) bool { return newerThan(after, found[i]) })
+	}
+	end := min(start+limit, len(found))
+
+	page := api.PastePage{Pastes: pasteList(found[start:end]), Total: len(found)}
+	if end < len(found) {
+		page.NextCursor = encodeCursor(found[end-1])
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// newerThan orders pastes newest first, by ID when created together
+func newerThan(a, b *storedPaste) bool {
+	if !a.createdAt.Equal(b.createdAt) {
+		return a.createdAt.After(b.createdAt)
+	}
+	return a.ID > b.ID
+}
+
+func pasteList(found []*storedPaste) []api.Paste {
+	list := make([]api.Paste, len(found))
+	for i, p := range found {
+		list[i] = p.Paste
+	}
+	return list
+}
+
+// cursors point at the last paste of a page by creation time and ID, so
+// pastes created or expiring in between do not shift the next page
+func encodeCursor(p *storedPaste) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%s", p.createdAt.UnixNano(), p.ID))
+}
+
+func decodeCursor(cursor string) (*storedPaste, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &storedPaste{Paste: api.Paste{ID: id}, createdAt: time.Unix(0, n)}, nil
+}
+
+// lookup resolves {id} the way the real server does: 400 for anything
+// that is not a UUID, 404 when unknown and 410 once expired
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) *storedPaste {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusBadRequest, "", "invalid paste ID")
+		return nil
+	}
+
+	s.mu.Lock()
+	p, ok := s.pastes[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "paste not found")
+		return nil
+	}
+	if !s.Now().Before(p.ExpiresAt) {
+		writeError(w, http.StatusGone, "", "paste has expired")
+		return nil
+	}
+	return p
+}
+
+func (s *Server) getPaste(w http.ResponseWriter, r *http.Request) {
+	if p := s.lookup(w, r); p != nil {
+		writeJSON(w, http.StatusOK, p.Paste)
+	}
+}
+
+func (s *Server) getRawPaste(w http.ResponseWriter, r *http.Request) {
+	p := s.lookup(w, r)
+	if p == nil {
+		return
+	}
+	if !p.Streamed {
+		writeError(w, http.StatusNotFound, "", "paste is not streamed, fetch it from /api/pastes/{id}")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(p.raw)))
+	w.Header().Set("X-Paste-Signature", p.Signature)
+	w.Header().Set("X-Paste-Public-Key", p.PublicKey)
+	w.Write(p.raw)
+}
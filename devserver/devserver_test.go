@@ -0,0 +1,298 @@
+package devserver_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/devserver"
+)
+
+type client struct {
+	t     *testing.T
+	url   string
+	id    string
+	pub   string
+	priv  ed25519.PrivateKey
+	token string
+}
+
+func newServer(t *testing.T) (*devserver.Server, *httptest.Server) {
+	t.Helper()
+	srv := devserver.New()
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func (c *client) do(method, path string, body any, out any) int {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.url+path, &buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// login registers a fresh key and answers a challenge with it
+func login(t *testing.T, baseURL string) *client {
+	t.Helper()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	c := &client{t: t, url: baseURL, pub: base64.StdEncoding.EncodeToString(pub), priv: priv}
+
+	var reg api.RegisterUserResponse
+	if status := c.do("POST", "/api/users", api.RegisterUserRequest{PublicKey: c.pub}, &reg); status != http.StatusCreated {
+		t.Fatalf("register: status %d", status)
+	}
+	c.id = reg.ID
+
+	nonce := c.challenge()
+	var auth api.AuthResponse
+	if status := c.do("POST", "/api/users/auth", c.answer(nonce), &auth); status != http.StatusOK {
+		t.Fatalf("auth: status %d", status)
+	}
+	c.token = auth.Token
+	return c
+}
+
+func (c *client) challenge() string {
+	c.t.Helper()
+	var ch api.ChallengeResponse
+	if status := c.do("POST", "/api/users/challenge", api.ChallengeRequest{ID: c.id}, &ch); status != http.StatusOK {
+		c.t.Fatalf("challenge: status %d", status)
+	}
+	return ch.Nonce
+}
+
+func (c *client) answer(nonce string) api.AuthRequest {
+	sig := ed25519.Sign(c.priv, api.ChallengeMessage(c.id, nonce))
+	return api.AuthRequest{
+		ID:        c.id,
+		PublicKey: c.pub,
+		Challenge: nonce,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}
+}
+
+func (c *client) pasteRequest(ciphertext []byte, expiresIn int) api.PasteRequest {
+	return api.PasteRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+		Signature:  base64.StdEncoding.EncodeToString(ed25519.Sign(c.priv, ciphertext)),
+		PublicKey:  c.pub,
+		ExpiresIn:  expiresIn,
+	}
+}
+
+func TestAuthRejectsReusedAndForgedChallenges(t *testing.T) {
+	_, ts := newServer(t)
+	c := login(t, ts.URL)
+
+	nonce := c.challenge()
+	if status := c.do("POST", "/api/users/auth", c.answer(nonce), nil); status != http.StatusOK {
+		t.Fatalf("first answer: status %d", status)
+	}
+	if status := c.do("POST", "/api/users/auth", c.answer(nonce), nil); status != http.StatusUnauthorized {
+		t.Fatalf("reused nonce: status %d, want 401", status)
+	}
+
+	forged := c.answer(c.challenge())
+	_, other, _ := ed25519.GenerateKey(nil)
+	forged.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(other, api.ChallengeMessage(c.id, forged.Challenge)))
+	if status := c.do("POST", "/api/users/auth", forged, nil); status != http.StatusUnauthorized {
+		t.Fatalf("forged signature: status %d, want 401", status)
+	}
+}
+
+func TestCreatePasteValidation(t *testing.T) {
+	_, ts := newServer(t)
+	c := login(t, ts.URL)
+
+	// the server only checks the title header is signed, it cannot open it
+	header := base64.StdEncoding.EncodeToString([]byte("sealed title"))
+	titled := func(priv ed25519.PrivateKey) func() api.PasteRequest {
+		return func() api.PasteRequest {
+			req := c.pasteRequest([]byte("ciphertext"), 86400)
+			req.TitleHeader = header
+			if priv != nil {
+				sig, err := crypt.SignTitle(base64.StdEncoding.EncodeToString(priv), header)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.TitleSignature = sig
+			}
+			return req
+		}
+	}
+	_, other, _ := ed25519.GenerateKey(nil)
+
+	tests := []struct {
+		name   string
+		req    func() api.PasteRequest
+		token  string
+		status int
+	}{
+		{"valid", func() api.PasteRequest { return c.pasteRequest([]byte("ciphertext"), 86400) }, c.token, http.StatusCreated},
+		{"no token", func() api.PasteRequest { return c.pasteRequest([]byte("ciphertext"), 86400) }, "", http.StatusUnauthorized},
+		{"expiry too long", func() api.PasteRequest { return c.pasteRequest([]byte("ciphertext"), 8*86400) }, c.token, http.StatusBadRequest},
+		{"bad signature", func() api.PasteRequest {
+			req := c.pasteRequest([]byte("ciphertext"), 86400)
+			req.Ciphertext = base64.StdEncoding.EncodeToString([]byte("tampered"))
+			return req
+		}, c.token, http.StatusBadRequest},
+		{"not base64", func() api.PasteRequest {
+			req := c.pasteRequest([]byte("ciphertext"), 86400)
+			req.Ciphertext = "%%%"
+			return req
+		}, c.token, http.StatusBadRequest},
+		{"signed title", titled(c.priv), c.token, http.StatusCreated},
+		{"unsigned title", titled(nil), c.token, http.StatusBadRequest},
+		{"title signed by another key", titled(other), c.token, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.token = tt.token
+			if status := c.do("POST", "/api/pastes", tt.req(), nil); status != tt.status {
+				t.Fatalf("status %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestGetPasteStatuses(t *testing.T) {
+	srv, ts := newServer(t)
+	c := login(t, ts.URL)
+
+	var created api.CreatePasteResponse
+	if status := c.do("POST", "/api/pastes", c.pasteRequest([]byte("ciphertext"), 3600), &created); status != http.StatusCreated {
+		t.Fatalf("create: status %d", status)
+	}
+
+	var got api.Paste
+	if status := c.do("GET", "/api/pastes/"+created.ID, nil, &got); status != http.StatusOK {
+		t.Fatalf("get: status %d", status)
+	}
+	if got.PublicKey != c.pub || got.ID != created.ID {
+		t.Fatalf("get returned %+v", got)
+	}
+
+	if status := c.do("GET", "/api/pastes/not-a-uuid", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("invalid ID: status %d, want 400", status)
+	}
+	if status := c.do("GET", "/api/pastes/00000000-0000-0000-0000-000000000000", nil, nil); status != http.StatusNotFound {
+		t.Fatalf("unknown ID: status %d, want 404", status)
+	}
+
+	srv.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if status := c.do("GET", "/api/pastes/"+created.ID, nil, nil); status != http.StatusGone {
+		t.Fatalf("expired: status %d, want 410", status)
+	}
+	var list []api.Paste
+	if status := c.do("GET", "/api/pastes?public_key="+url.QueryEscape(c.pub), nil, &list); status != http.StatusOK || len(list) != 0 {
+		t.Fatalf("expired pastes listed: status %d, %d pastes", status, len(list))
+	}
+}
+
+func TestListPastesPages(t *testing.T) {
+	_, ts := newServer(t)
+	c := login(t, ts.URL)
+
+	for i := range 5 {
+		if status := c.do("POST", "/api/pastes", c.pasteRequest([]byte{byte(i)}, 3600), nil); status != http.StatusCreated {
+			t.Fatalf("create %d: status %d", i, status)
+		}
+	}
+
+	seen := map[string]bool{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		query := url.Values{"public_key": {c.pub}, "limit": {"2"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		var page api.PastePage
+		if status := c.do("GET", "/api/pastes?"+query.Encode(), nil, &page); status != http.StatusOK {
+			t.Fatalf("page %d: status %d", pages, status)
+		}
+		if page.Total != 5 || len(page.Pastes) > 2 {
+			t.Fatalf("page %d: total %d, %d pastes", pages, page.Total, len(page.Pastes))
+		}
+		for _, p := range page.Pastes {
+			if seen[p.ID] {
+				t.Fatalf("paste %s listed twice", p.ID)
+			}
+			seen[p.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Fatalf("listed %d pastes, want 5", len(seen))
+	}
+
+	if status := c.do("GET", "/api/pastes?public_key="+url.QueryEscape(c.pub)+"&cursor=%25%25", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("bad cursor: status %d, want 400", status)
+	}
+}
+
+func TestCreatePasteIdempotencyKey(t *testing.T) {
+	srv, ts := newServer(t)
+	c := login(t, ts.URL)
+	body, _ := json.Marshal(c.pasteRequest([]byte("ciphertext"), 86400))
+
+	create := func(key string) string {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL+"/api/pastes", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var created api.CreatePasteResponse
+		if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&created) != nil {
+			t.Fatalf("create: status %d", resp.StatusCode)
+		}
+		return created.ID
+	}
+
+	first := create("temp-1")
+	if again := create("temp-1"); again != first {
+		t.Fatalf("repeated key made paste %s, want %s", again, first)
+	}
+	if other := create("temp-2"); other == first {
+		t.Fatal("a new key returned the old paste")
+	}
+	if n := srv.PasteCount(); n != 2 {
+		t.Fatalf("%d pastes stored, want 2", n)
+	}
+}
@@ -0,0 +1,191 @@
+// Package doctor cross-checks the local paste keys with the pastes the
+// server lists for the user, the way `dropkey keys doctor` and the
+// Settings tab report it.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+)
+
+// KeyState says why a local key has no paste in the server list.
+type KeyState string
+
+const (
+	// Expired keys belong to pastes the server reports as expired, they
+	// can never be used again.
+	Expired KeyState = "expired"
+	// Unknown keys are for pastes the server does not know: deleted
+	// pastes, or temporary IDs of uploads that never completed.
+	Unknown KeyState = "not on server"
+)
+
+// Orphan is a local key without a listed paste.
+type Orphan struct {
+	ID    string
+	State KeyState
+}
+
+// Report is the outcome of Check.
+type Report struct {
+	Keys   int
+	Pastes int
+	// Recovered maps temp IDs to the paste IDs their keys were moved to
+	Recovered map[string]string
+	Orphans   []Orphan
+	// Missing lists pastes on the server that have no local key
+	Missing []string
+	// Unreadable lists key files that are corrupt
+	Unreadable []string
+}
+
+// Expired returns the IDs of the orphaned keys whose paste expired.
+func (r *Report) Expired() []string {
+	var ids []string
+	for _, o := range r.Orphans {
+		if o.State == Expired {
+			ids = append(ids, o.ID)
+		}
+	}
+	return ids
+}
+
+// Healthy reports whether there is nothing to act on.
+func (r *Report) Healthy() bool {
+	return len(r.Orphans) == 0 && len(r.Missing) == 0 && len(r.Unreadable) == 0
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d paste keys, %d pastes on the server.\n", r.Keys, r.Pastes)
+	if len(r.Recovered) > 0 {
+		fmt.Fprintf(&b, "%d keys left under a temporary ID by an interrupted upload were moved to their paste.\n", len(r.Recovered))
+	}
+	if n := len(r.Expired()); n > 0 {
+		fmt.Fprintf(&b, "%d keys belong to expired pastes and can be deleted.\n", n)
+	}
+	if n := len(r.Orphans) - len(r.Expired()); n > 0 {
+		fmt.Fprintf(&b, "%d keys are for pastes the server does not know, deleted pastes or uploads that never completed:\n", n)
+		for _, o := range r.Orphans {
+			if o.State == Unknown {
+				b.WriteString("  " + o.ID + "\n")
+			}
+		}
+	}
+	if len(r.Missing) > 0 {
+		fmt.Fprintf(&b, "%d pastes have no local key and cannot be decrypted here, restore a backup to read them:\n", len(r.Missing))
+		for _, id := range r.Missing {
+			b.WriteString("  " + id + "\n")
+		}
+	}
+	if len(r.Unreadable) > 0 {
+		fmt.Fprintf(&b, "%d key files are corrupt:\n", len(r.Unreadable))
+		for _, id := range r.Unreadable {
+			b.WriteString("  " + id + "\n")
+		}
+	}
+	if r.Healthy() {
+		b.WriteString("Every key matches a paste.\n")
+	}
+	return b.String()
+}
+
+// Check lists the pastes of the current and every retired identity key,
+// recovers keys orphaned by interrupted uploads and asks the server about
+// every key that is still left over. Nothing is deleted.
+func Check(ctx context.Context, store config.Store, keys crypt.KeyStore) (*Report, error) {
+	cfg, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// streamed pastes are listed without a ciphertext, they only need to
+	// be known so their keys are not taken for orphans
+	ciphertexts := map[string]string{}
+	for _, pub := range cfg.PublicKeys() {
+		switch msg := api.GetPastes(ctx, pub)().(type) {
+		case api.PasteListFetchedMsg:
+			for _, p := range msg.List {
+				ciphertexts[p.ID] = p.Ciphertext
+			}
+		case api.ErrMsg:
+			return nil, fmt.Errorf("failed to list pastes: %w", msg)
+		}
+	}
+
+	report := &Report{Pastes: len(ciphertexts)}
+	report.Recovered, err = crypt.RecoverOrphans(keys, ciphertexts)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := keys.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paste keys: %w", err)
+	}
+	report.Keys = len(ids)
+
+	local := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		local[id] = true
+		if _, err := keys.GetKey(id); err != nil {
+			report.Unreadable = append(report.Unreadable, id)
+			continue
+		}
+		if _, listed := ciphertexts[id]; listed {
+			continue
+		}
+
+		state, err := pasteState(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if state != "" {
+			report.Orphans = append(report.Orphans, Orphan{ID: id, State: state})
+		}
+	}
+
+	for id := range ciphertexts {
+		if !local[id] {
+			report.Missing = append(report.Missing, id)
+		}
+	}
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// pasteState asks the server about a paste that is not in the list. A
+// paste that is still there, signed by a key that is not ours, is not an
+// orphan and gets an empty state.
+func pasteState(ctx context.Context, id string) (KeyState, error) {
+	msg := api.GetPaste(ctx, id)()
+	err, ok := msg.(api.ErrMsg)
+	if !ok {
+		return "", nil
+	}
+	switch {
+	case errors.Is(err, api.ErrPasteExpired):
+		return Expired, nil
+	case errors.Is(err, api.ErrPasteNotFound), errors.Is(err, api.ErrInvalidPasteID):
+		return Unknown, nil
+	}
+	return "", fmt.Errorf("failed to look up paste %s: %w", id, err)
+}
+
+// Shred securely deletes the keys with the given IDs and returns how many
+// were removed.
+func Shred(keys crypt.KeyStore, ids []string) (int, error) {
+	for i, id := range ids {
+		if err := crypt.ShredKey(keys, id); err != nil {
+			return i, fmt.Errorf("failed to delete key %s: %w", id, err)
+		}
+	}
+	return len(ids), nil
+}
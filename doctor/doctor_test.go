@@ -0,0 +1,108 @@
+package doctor_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/devserver"
+	"Drop-Key-TUI/doctor"
+	"Drop-Key-TUI/paste"
+
+	"github.com/google/uuid"
+)
+
+func TestCheck(t *testing.T) {
+	server := devserver.New()
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	api.SetBackendURL(ts.URL)
+
+	store := config.NewMemoryStore()
+	keys := crypt.NewMemoryKeyStore()
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	cfg := &config.Config{
+		PublicKey:  base64.StdEncoding.EncodeToString(pub),
+		PrivateKey: base64.StdEncoding.EncodeToString(priv),
+	}
+	if err := store.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	userID := api.RegisterUser(t.Context(), cfg.PublicKey)().(api.RegisterUserResponse).ID
+	challenge := api.RequestChallenge(t.Context(), userID)().(api.ChallengeMsg)
+	token := api.AuthenticateUser(t.Context(), api.AuthRequest{
+		ID:        userID,
+		PublicKey: cfg.PublicKey,
+		Challenge: challenge.Nonce,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, api.ChallengeMessage(userID, challenge.Nonce))),
+	})().(api.AuthResponse).Token
+
+	// upload returns the paste ID, the key stays under the temp ID unless
+	// remap is set
+	upload := func(expiresIn int, remap bool) string {
+		sealed, err := paste.Seal(keys, paste.Text("t", "body"), paste.None, cfg.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		created := api.CreatePaste(t.Context(), api.PasteRequest{
+			Ciphertext: sealed.Ciphertext,
+			Signature:  sealed.Signature,
+			PublicKey:  cfg.PublicKey,
+			ExpiresIn:  expiresIn,
+		}, token, sealed.TempID)().(api.PasteCreatedMsg)
+		if remap {
+			if err := crypt.MoveKey(keys, created.TempID, created.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return created.ID
+	}
+
+	expiring := upload(3600, true)
+	upload(86400, true)
+	interrupted := upload(86400, false)
+	missing := upload(86400, true)
+	if err := keys.DeleteKey(missing); err != nil {
+		t.Fatal(err)
+	}
+	neverUploaded := uuid.New().String()
+	if _, err := crypt.GenerateKey(keys, neverUploaded); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	server.Now = func() time.Time { return later }
+
+	report, err := doctor.Check(t.Context(), store, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Recovered) != 1 {
+		t.Errorf("recovered = %v, want the interrupted upload", report.Recovered)
+	}
+	if _, err := keys.GetKey(interrupted); err != nil {
+		t.Errorf("interrupted upload still has no key: %v", err)
+	}
+	if got := report.Expired(); len(got) != 1 || got[0] != expiring {
+		t.Errorf("expired = %v, want %s", got, expiring)
+	}
+	if len(report.Orphans) != 2 {
+		t.Errorf("orphans = %v, want the expired and the never uploaded key", report.Orphans)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != missing {
+		t.Errorf("missing = %v, want %s", report.Missing, missing)
+	}
+
+	if n, err := doctor.Shred(keys, report.Expired()); err != nil || n != 1 {
+		t.Fatalf("shred = %d, %v", n, err)
+	}
+	if _, err := keys.GetKey(expiring); err == nil {
+		t.Error("expired key is still there")
+	}
+}
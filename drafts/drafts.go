@@ -0,0 +1,272 @@
+// Package drafts keeps unpublished pastes on disk, encrypted, so a closed
+// terminal or a stray keypress does not lose them.
+package drafts
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/fsutil"
+
+	"github.com/google/uuid"
+)
+
+const (
+	draftsDir = "drafts"
+	keyFile   = ".key"
+	draftExt  = ".draft"
+)
+
+type Draft struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store reads and writes drafts under the config store's directory. Every draft
+// is sealed with AES-256-GCM under a random drafts key, with the draft ID
+// as additional data so files cannot be swapped. The drafts key is kept
+// next to them wrapped under a key derived from the identity private key,
+// so the drafts directory on its own does not open them.
+type Store struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// wrapKeyLabel derives the key that wraps the drafts key from the
+// identity private key
+const wrapKeyLabel = "DropKey-Drafts-v1"
+
+// Open returns the draft store kept in the directory of store, creating
+// it and its key on first use. It needs the identity in store.
+func Open(store config.Store) (*Store, error) {
+	base, err := store.Dir()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	wrap, err := wrapAEAD(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(base, draftsDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	key, err := loadOrCreateKey(filepath.Join(dir, keyFile), wrap)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, aead: aead}, nil
+}
+
+// Rewrap wraps the drafts key in the directory of store under a new
+// identity private key, after a key rotation. There is nothing to do when
+// no draft was ever saved.
+func Rewrap(store config.Store, oldPrivateKey, newPrivateKey string) error {
+	base, err := store.Dir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(base, draftsDir, keyFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	oldWrap, err := wrapAEAD(oldPrivateKey)
+	if err != nil {
+		return err
+	}
+	key, err := unwrapKey(oldWrap, data)
+	if err != nil {
+		return err
+	}
+	newWrap, err := wrapAEAD(newPrivateKey)
+	if err != nil {
+		return err
+	}
+	return writeKey(path, newWrap, key)
+}
+
+func wrapAEAD(privateKey string) (cipher.AEAD, error) {
+	priv, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("identity private key is invalid")
+	}
+	mac := hmac.New(sha256.New, ed25519.PrivateKey(priv).Seed())
+	mac.Write([]byte(wrapKeyLabel))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func loadOrCreateKey(path string, wrap cipher.AEAD) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return unwrapKey(wrap, data)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := writeKey(path, wrap, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func unwrapKey(wrap cipher.AEAD, data []byte) ([]byte, error) {
+	nonceSize := wrap.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("drafts key is corrupt")
+	}
+	key, err := wrap.Open(nil, data[:nonceSize], data[nonceSize:], []byte(wrapKeyLabel))
+	if err != nil {
+		return nil, errors.New("drafts key does not open with this identity")
+	}
+	if len(key) != 32 {
+		return nil, errors.New("drafts key is corrupt")
+	}
+	return key, nil
+}
+
+func writeKey(path string, wrap cipher.AEAD, key []byte) error {
+	nonce := make([]byte, wrap.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := wrap.Seal(nonce, nonce, key, []byte(wrapKeyLabel))
+
+	if err := fsutil.WriteFile(path, sealed, 0o600); err != nil {
+		return fmt.Errorf("failed to write drafts key: %w", err)
+	}
+	return nil
+}
+
+// NewID returns an ID for a draft that has not been saved yet.
+func NewID() string {
+	return uuid.New().String()
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+draftExt)
+}
+
+// Save writes the draft, replacing any earlier version with the same ID.
+func (s *Store) Save(d Draft) error {
+	if d.ID == "" || strings.ContainsAny(d.ID, `/\`) {
+		return fmt.Errorf("invalid draft ID %q", d.ID)
+	}
+
+	plaintext, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal draft: %w", err)
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(d.ID))
+
+	if err := fsutil.WriteFile(s.path(d.ID), sealed, 0o600); err != nil {
+		return fmt.Errorf("failed to write draft: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) load(id string) (*Draft, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("draft is truncated")
+	}
+	plaintext, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt draft %s: %w", id, err)
+	}
+
+	var d Draft
+	if err := json.Unmarshal(plaintext, &d); err != nil {
+		return nil, fmt.Errorf("failed to decode draft: %w", err)
+	}
+	return &d, nil
+}
+
+// List returns the drafts, most recently edited first. Drafts that cannot
+// be decrypted are skipped rather than failing the whole list.
+func (s *Store) List() ([]Draft, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Draft
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), draftExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		d, err := s.load(id)
+		if err != nil {
+			continue
+		}
+		list = append(list, *d)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.After(list[j].UpdatedAt) })
+	return list, nil
+}
+
+// Delete removes a draft. Deleting a draft that does not exist is not an
+// error.
+func (s *Store) Delete(id string) error {
+	if id == "" {
+		return nil
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
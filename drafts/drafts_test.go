@@ -0,0 +1,88 @@
+package drafts
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Drop-Key-TUI/config"
+)
+
+func newIdentity(t *testing.T) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(priv)
+}
+
+func newStore(t *testing.T, privateKey string) *config.MemoryStore {
+	t.Helper()
+	store := config.NewMemoryStore()
+	store.UseDir(t.TempDir())
+	if err := store.Save(&config.Config{PublicKey: "pub", PrivateKey: privateKey}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestKeyIsWrapped(t *testing.T) {
+	store := newStore(t, newIdentity(t))
+	s, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Draft{ID: NewID(), Title: "t", Body: "secret", UpdatedAt: time.Now()}
+	if err := s.Save(d); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _ := store.Dir()
+	data, err := os.ReadFile(filepath.Join(dir, draftsDir, keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 32 {
+		t.Fatal("drafts key is stored in the clear")
+	}
+
+	// another identity pointed at the same directory cannot open them
+	other := config.NewMemoryStore()
+	other.UseDir(dir)
+	other.Save(&config.Config{PublicKey: "pub", PrivateKey: newIdentity(t)})
+	if _, err := Open(other); err == nil {
+		t.Fatal("opened with the wrong identity")
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey, newKey := newIdentity(t), newIdentity(t)
+	store := newStore(t, oldKey)
+	s, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Draft{ID: NewID(), Body: "kept across a rotation", UpdatedAt: time.Now()}
+	if err := s.Save(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(&config.Config{PublicKey: "pub", PrivateKey: newKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rewrap(store, oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List()
+	if err != nil || len(list) != 1 || list[0].Body != d.Body {
+		t.Fatalf("drafts after rotation: %+v, %v", list, err)
+	}
+}
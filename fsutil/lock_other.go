@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package fsutil
+
+import "os"
+
+// there is no flock here, the files are still replaced atomically but two
+// instances are not kept from racing each other
+
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
+
+// directories cannot be opened for syncing on Windows
+func syncUnsupported(err error) bool { return true }
@@ -4,13 +4,24 @@ import (
 	"fmt"
 	"os"
 
+	"Drop-Key-TUI/cli"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
 	"Drop-Key-TUI/tui"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
-	p := tea.NewProgram(tui.New(), tea.WithAltScreen())
+	if len(os.Args) > 1 {
+		if err := cli.Run(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	p := tea.NewProgram(tui.New(config.FSStore{}, crypt.FSKeyStore{}), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -0,0 +1,144 @@
+package paste
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression names the algorithm applied to a payload body before it is
+// encrypted. It is recorded in the payload header.
+type Compression string
+
+const (
+	None Compression = ""
+	Gzip Compression = "gzip"
+	Zstd Compression = "zstd"
+	// Auto compresses with zstd only when it saves space, and otherwise
+	// writes the oldest format that can carry the payload.
+	Auto Compression = "auto"
+)
+
+// autoMinSize and autoMinSaving keep Auto from giving up compatibility
+// with older clients for a handful of bytes.
+const (
+	autoMinSize   = 1 << 10
+	autoMinSaving = 10 // percent
+)
+
+// ParseCompression accepts the values of the -compress flag and the
+// compression config setting. An empty string means None, compressed
+// pastes cannot be opened by clients older than the DKPASTE\x02 framing,
+// so users opt in once the people they share with have upgraded.
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "auto":
+		return Auto, nil
+	case "", "none", "off":
+		return None, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	}
+	return None, fmt.Errorf("unknown compression %q, expected auto, zstd, gzip or none", s)
+}
+
+// compress returns body compressed with c. Auto falls back to None when
+// compression does not pay off.
+func compress(c Compression, body []byte) (Compression, []byte, error) {
+	if c == Auto {
+		if len(body) < autoMinSize {
+			return None, body, nil
+		}
+		_, packed, err := compress(Zstd, body)
+		if err != nil {
+			return None, nil, err
+		}
+		if len(packed)*100 > len(body)*(100-autoMinSaving) {
+			return None, body, nil
+		}
+		return Zstd, packed, nil
+	}
+	if c == None {
+		return None, body, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := newCompressor(c, &buf)
+	if err != nil {
+		return None, nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return None, nil, err
+	}
+	if err := w.Close(); err != nil {
+		return None, nil, err
+	}
+	return c, buf.Bytes(), nil
+}
+
+// newCompressor wraps w for streamed bodies. Auto is treated as zstd since
+// the saving cannot be measured before the stream is sent.
+func newCompressor(c Compression, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd, Auto:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown compression %q", c)
+}
+
+// newDecompressor undoes newCompressor. limit bounds how much the body
+// may expand to, so a small paste cannot decompress into gigabytes.
+func newDecompressor(c Compression, r io.Reader, limit int64) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	switch c {
+	case None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		body = gz
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %w", err)
+		}
+		body = zr.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("paste uses unsupported compression %q, upgrade DropKey to open it", c)
+	}
+	if limit < 0 {
+		return body, nil
+	}
+	return &limitedBody{ReadCloser: body, left: limit}, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (l *limitedBody) Read(b []byte) (int, error) {
+	if l.left <= 0 {
+		// anything beyond the limit means the header lied about the size
+		var probe [1]byte
+		if n, _ := l.ReadCloser.Read(probe[:]); n > 0 {
+			return 0, fmt.Errorf("paste body is larger than its header says")
+		}
+		return 0, io.EOF
+	}
+	if int64(len(b)) > l.left {
+		b = b[:l.left]
+	}
+	n, err := l.ReadCloser.Read(b)
+	l.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,369 @@
+// Package paste defines what goes inside the encrypted blob of a paste:
+// either a titled text note or a file attachment with its metadata.
+package paste
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxSize caps attachments, the whole payload is held in memory while it
+// is encrypted and uploaded.
+const MaxSize = 25 << 20
+
+// TextMIME is the type of plain notes typed into the form.
+const TextMIME = "text/markdown; charset=utf-8"
+
+// magic starts every framed payload, the last byte is the version.
+// Version 2 adds body compression, uncompressed payloads are still
+// written as version 1 and text notes keep the original JSON layout, so
+// older clients can read everything that does not need the newer format.
+var (
+	magic           = []byte("DKPASTE\x01")
+	magicCompressed = []byte("DKPASTE\x02")
+)
+
+var ErrTooLarge = fmt.Errorf("attachments are limited to %d MiB here, upload larger files with `dropkey put -file`", MaxSize>>20)
+
+// Payload is the decrypted content of a paste.
+type Payload struct {
+	Title    string `json:"title"`
+	Filename string `json:"filename,omitempty"`
+	MIME     string `json:"mime"`
+	Size     int64  `json:"size"` // -1 when streamed from a pipe
+	// Compression is how the body was packed on the wire, the Body of a
+	// decoded payload is always uncompressed
+	Compression Compression `json:"compression,omitempty"`
+	Body        []byte      `json:"-"`
+}
+
+// legacyPayload is the JSON blob written before attachments existed.
+type legacyPayload struct {
+	Title string `json:"title"`
+	Paste string `json:"paste"`
+}
+
+// Text returns the payload for a note typed into the editor.
+func Text(title, body string) *Payload {
+	return &Payload{
+		Title: title,
+		MIME:  TextMIME,
+		Size:  int64(len(body)),
+		Body:  []byte(body),
+	}
+}
+
+// FromFile reads path into an attachment payload. The title defaults to
+// the file name.
+func FromFile(path, title string) (*Payload, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+	if title == "" {
+		title = name
+	}
+	return &Payload{
+		Title:    title,
+		Filename: name,
+		MIME:     detectMIME(name, body),
+		Size:     int64(len(body)),
+		Body:     body,
+	}, nil
+}
+
+// OpenFile is FromFile for files that are streamed instead of read into
+// memory. The returned payload has no Body, read it from the file.
+func OpenFile(path, title string) (*Payload, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	// DetectContentType looks at no more than 512 bytes
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	name := filepath.Base(path)
+	if title == "" {
+		title = name
+	}
+	return &Payload{
+		Title:    title,
+		Filename: name,
+		MIME:     detectMIME(name, sniff[:n]),
+		Size:     info.Size(),
+	}, f, nil
+}
+
+func detectMIME(name string, body []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(body)
+}
+
+// IsAttachment reports whether the payload came from a file rather than
+// the editor.
+func (p *Payload) IsAttachment() bool {
+	return p.Filename != ""
+}
+
+// IsText reports whether the body can be rendered in the viewer. Anything
+// else is offered for saving instead.
+func (p *Payload) IsText() bool {
+	if !utf8.Valid(p.Body) || bytes.IndexByte(p.Body, 0) >= 0 {
+		return false
+	}
+	return !p.IsAttachment() || textMIME(p.MIME)
+}
+
+func textMIME(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"),
+		strings.HasSuffix(mediaType, "yaml"), mediaType == "application/x-sh",
+		mediaType == "application/toml":
+		return true
+	}
+	return false
+}
+
+// Describe is a one line summary of an attachment, e.g.
+// "config.tar.gz · application/gzip · 12.3 KiB".
+func (p *Payload) Describe() string {
+	return fmt.Sprintf("%s · %s · %s", p.Filename, p.MIME, HumanSize(p.Size))
+}
+
+func HumanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// Marshal encodes the payload for encryption without compression.
+func (p *Payload) Marshal() ([]byte, error) {
+	return p.MarshalCompressed(None)
+}
+
+// MarshalCompressed encodes the payload for encryption, compressing the
+// body with c. Uncompressed text notes use the legacy JSON blob, anything
+// else uses magic, a big-endian header length, the JSON header and then
+// the raw (or compressed) body bytes.
+func (p *Payload) MarshalCompressed(c Compression) ([]byte, error) {
+	algo, body, err := compress(c, p.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress paste: %w", err)
+	}
+	if algo == None && !p.IsAttachment() {
+		return json.Marshal(legacyPayload{Title: p.Title, Paste: string(p.Body)})
+	}
+
+	framed := *p
+	framed.Compression = algo
+	header, err := framed.MarshalHeader()
+	if err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+// MarshalHeader encodes everything of the framed format except the body,
+// streamed pastes write it before copying the body through.
+func (p *Payload) MarshalHeader() ([]byte, error) {
+	header, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload header: %w", err)
+	}
+
+	buf := make([]byte, 0, len(magic)+4+len(header)+len(p.Body))
+	if p.Compression != None {
+		buf = append(buf, magicCompressed...)
+	} else {
+		buf = append(buf, magic...)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(header)))
+	return append(buf, header...), nil
+}
+
+// maxHeaderSize bounds what ReadHeader allocates for a hostile stream
+const maxHeaderSize = 64 << 10
+
+// ReadHeader reads a framed payload header from r, leaving r at the first
+// body byte. The returned payload has no Body.
+func ReadHeader(r io.Reader) (*Payload, error) {
+	prefix := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, errors.New("attachment payload is truncated")
+	}
+	compressed := bytes.Equal(prefix[:len(magic)], magicCompressed)
+	if !compressed && !bytes.Equal(prefix[:len(magic)], magic) {
+		return nil, errors.New("not a framed paste payload")
+	}
+	headerLen := binary.BigEndian.Uint32(prefix[len(magic):])
+	if headerLen > maxHeaderSize {
+		return nil, errors.New("attachment header is too large")
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.New("attachment header is truncated")
+	}
+	var p Payload
+	if err := json.Unmarshal(header, &p); err != nil {
+		return nil, fmt.Errorf("invalid attachment header: %w", err)
+	}
+	if compressed != (p.Compression != None) {
+		return nil, errors.New("payload version does not match its compression")
+	}
+	return &p, nil
+}
+
+// Unmarshal decodes a decrypted paste in either format.
+func Unmarshal(data []byte) (*Payload, error) {
+	if !bytes.HasPrefix(data, magic) && !bytes.HasPrefix(data, magicCompressed) {
+		var legacy legacyPayload
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("invalid paste payload: %w", err)
+		}
+		return Text(legacy.Title, legacy.Paste), nil
+	}
+
+	r := bytes.NewReader(data)
+	p, err := ReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Body = data[len(data)-r.Len():]
+	if p.Compression != None {
+		limit := p.Size
+		if limit < 0 {
+			limit = MaxSize
+		}
+		body, err := newDecompressor(p.Compression, r, limit)
+		if err != nil {
+			return nil, err
+		}
+		p.Body, err = io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress paste: %w", err)
+		}
+	}
+	if p.Size >= 0 && p.Size != int64(len(p.Body)) {
+		return nil, fmt.Errorf("attachment is %d bytes, header says %d", len(p.Body), p.Size)
+	}
+	return p, nil
+}
+
+// Save writes the body into dir under the attachment's file name, adding
+// a numeric suffix instead of overwriting an existing file. It returns the
+// path written.
+func (p *Payload) Save(dir string) (string, error) {
+	return p.SaveFrom(dir, bytes.NewReader(p.Body))
+}
+
+// SaveFrom is Save for a body that is still being read, such as a
+// streamed paste. The partial file is removed if body fails.
+func (p *Payload) SaveFrom(dir string, body io.Reader) (string, error) {
+	name := safeFilename(p.Filename)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for i := 0; i < 100; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		path := filepath.Join(dir, candidate)
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(f, body); err != nil {
+			f.Close()
+			os.Remove(path)
+			return "", err
+		}
+		return path, f.Close()
+	}
+	return "", fmt.Errorf("too many files named %s in %s", name, dir)
+}
+
+// safeFilename keeps a sender-chosen name from escaping the target
+// directory or hiding itself.
+func safeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimLeft(name, ".")
+	if name == "" || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// DownloadDir is where viewers save attachments: ~/Downloads when it
+// exists, the home directory otherwise.
+func DownloadDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	downloads := filepath.Join(home, "Downloads")
+	if info, err := os.Stat(downloads); err == nil && info.IsDir() {
+		return downloads, nil
+	}
+	return home, nil
+}
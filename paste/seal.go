@@ -0,0 +1,58 @@
+package paste
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+
+	"Drop-Key-TUI/crypt"
+
+	"github.com/google/uuid"
+)
+
+// Sealed is a payload encrypted under a fresh per-paste key and signed,
+// ready to be sent to the server. The key is stored under TempID until
+// the server assigns the paste its ID.
+type Sealed struct {
+	TempID      string
+	Ciphertext  string
+	Signature   string
+	TitleHeader string
+	// TitleSignature covers TitleHeader, see crypt.SignTitle
+	TitleSignature string
+}
+
+// Seal compresses the payload with c, encrypts it and signs the raw
+// ciphertext with the base64 Ed25519 private key. The paste key goes into ks.
+func Seal(ks crypt.KeyStore, p *Payload, c Compression, privateKeyB64 string) (*Sealed, error) {
+	plaintext, err := p.MarshalCompressed(c)
+	if err != nil {
+		return nil, err
+	}
+
+	privKey, err := base64.StdEncoding.DecodeString(privateKeyB64)
+	if err != nil || len(privKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("configured private key is invalid")
+	}
+
+	// use a new temp id to encrypt each new paste
+	tempID := uuid.New().String()
+	encrypted, err := crypt.EncryptPaste(ks, tempID, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	titleHeader, titleSignature, err := SealTitle(ks, tempID, p, privateKeyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := ed25519.Sign(privKey, encrypted)
+	return &Sealed{
+		TempID:         tempID,
+		Ciphertext:     base64.StdEncoding.EncodeToString(encrypted),
+		Signature:      base64.StdEncoding.EncodeToString(signature),
+		TitleHeader:    titleHeader,
+		TitleSignature: titleSignature,
+	}, nil
+}
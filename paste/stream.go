@@ -0,0 +1,207 @@
+package paste
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"Drop-Key-TUI/crypt"
+
+	"github.com/google/uuid"
+)
+
+// SealedStream is the ciphertext of a streamed paste, produced as it is
+// read. The signature covers the whole ciphertext, so it is only
+// available once the stream has been read to the end.
+type SealedStream struct {
+	TempID         string
+	TitleHeader    string
+	TitleSignature string
+
+	r          io.Reader
+	digest     hash.Hash
+	privateKey string
+	eof        bool
+}
+
+// SealStream encrypts the payload header followed by body, compressed
+// with c. p.Body is ignored, and p.Size may be -1 when the length is not
+// known up front.
+func SealStream(ks crypt.KeyStore, p *Payload, body io.Reader, c Compression, privateKeyB64 string) (*SealedStream, error) {
+	framed := *p
+	framed.Compression = streamCompression(c, p.MIME)
+	header, err := framed.MarshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	tempID := uuid.New().String()
+	pr, pw := io.Pipe()
+	enc, err := crypt.NewStreamEncrypter(ks, tempID, pw)
+	if err != nil {
+		return nil, err
+	}
+	titleHeader, titleSignature, err := SealTitle(ks, tempID, p, privateKeyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_, err := enc.Write(header)
+		if err == nil {
+			err = copyCompressed(enc, body, framed.Compression, p.Size)
+		}
+		if err == nil {
+			err = enc.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	digest := sha512.New()
+	return &SealedStream{
+		TempID:         tempID,
+		TitleHeader:    titleHeader,
+		TitleSignature: titleSignature,
+		r:              io.TeeReader(pr, digest),
+		digest:         digest,
+		privateKey:     privateKeyB64,
+	}, nil
+}
+
+func (s *SealedStream) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	if err == io.EOF {
+		s.eof = true
+	}
+	return n, err
+}
+
+// Signature signs the digest of everything read so far.
+func (s *SealedStream) Signature() (string, error) {
+	if !s.eof {
+		return "", errors.New("stream signature requested before the end of the stream")
+	}
+	return crypt.SignStreamDigest(s.privateKey, s.digest.Sum(nil))
+}
+
+// streamCompression resolves Auto for a stream, where the saving cannot
+// be measured up front: text is compressed, anything else is likely to be
+// compressed already.
+func streamCompression(c Compression, contentType string) Compression {
+	if c != Auto {
+		return c
+	}
+	if textMIME(contentType) {
+		return Zstd
+	}
+	return None
+}
+
+// copyCompressed copies body through the compressor and, when size is
+// known, checks it did not change while being read.
+func copyCompressed(w io.Writer, body io.Reader, c Compression, size int64) error {
+	var n int64
+	var err error
+	if c == None {
+		n, err = io.Copy(w, body)
+	} else {
+		var zw io.WriteCloser
+		if zw, err = newCompressor(c, w); err != nil {
+			return err
+		}
+		if n, err = io.Copy(zw, body); err == nil {
+			err = zw.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("input changed while reading: expected %d bytes, read %d", size, n)
+	}
+	return nil
+}
+
+// OpenedStream is a verified streamed paste ready to be decrypted.
+type OpenedStream struct {
+	Payload *Payload
+	Status  crypt.TrustStatus
+	// Body yields the decrypted body, nil when the signature is bad
+	Body io.Reader
+
+	spool        *os.File
+	decompressor io.Closer
+}
+
+// OpenStream spools the downloaded ciphertext to a temporary file while
+// hashing it, so the signature is checked before anything is decrypted
+// without holding the paste in memory. A bad signature is not an error,
+// as with crypt.VerifyAndOpen. Close removes the temporary file.
+func OpenStream(ks crypt.KeyStore, id string, ciphertext io.Reader, signatureB64, publicKeyB64 string, known func(string) bool) (*OpenedStream, error) {
+	spool, err := os.CreateTemp("", "dropkey-*.stream")
+	if err != nil {
+		return nil, err
+	}
+	opened := &OpenedStream{spool: spool}
+
+	digest := sha512.New()
+	if _, err := io.Copy(io.MultiWriter(spool, digest), ciphertext); err != nil {
+		opened.Close()
+		return nil, fmt.Errorf("failed to download paste: %w", err)
+	}
+
+	opened.Status = crypt.VerifyStreamDigest(digest.Sum(nil), signatureB64, publicKeyB64, known)
+	if opened.Status == crypt.BadSignature {
+		return opened, nil
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		opened.Close()
+		return nil, err
+	}
+	plain, err := crypt.NewStreamDecrypter(ks, id, spool)
+	if err != nil {
+		opened.Close()
+		return nil, err
+	}
+	opened.Payload, err = ReadHeader(plain)
+	if err != nil {
+		opened.Close()
+		return nil, err
+	}
+	body, err := newDecompressor(opened.Payload.Compression, plain, opened.Payload.Size)
+	if err != nil {
+		opened.Close()
+		return nil, err
+	}
+	opened.decompressor = body
+	opened.Body = &sizedReader{r: body, want: opened.Payload.Size}
+	return opened, nil
+}
+
+func (o *OpenedStream) Close() error {
+	if o.decompressor != nil {
+		o.decompressor.Close()
+	}
+	o.spool.Close()
+	return os.Remove(o.spool.Name())
+}
+
+// sizedReader fails at EOF if the body length does not match the header
+type sizedReader struct {
+	r    io.Reader
+	want int64
+	read int64
+}
+
+func (s *sizedReader) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	s.read += int64(n)
+	if err == io.EOF && s.want >= 0 && s.read != s.want {
+		return n, fmt.Errorf("paste body is %d bytes, header says %d", s.read, s.want)
+	}
+	return n, err
+}
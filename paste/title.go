@@ -0,0 +1,55 @@
+package paste
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"Drop-Key-TUI/crypt"
+)
+
+// TitleHeader is what a paste list shows. It is sealed apart from the
+// body, see crypt.SealTitle, so listing never decrypts whole pastes.
+type TitleHeader struct {
+	Title    string `json:"title"`
+	Filename string `json:"filename,omitempty"`
+	MIME     string `json:"mime,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+func (h *TitleHeader) IsAttachment() bool {
+	return h.Filename != ""
+}
+
+// SealTitle encrypts the title header of p under the key stored for id
+// and signs it with the base64 Ed25519 private key.
+func SealTitle(ks crypt.KeyStore, id string, p *Payload, privateKeyB64 string) (header, signature string, err error) {
+	data, err := json.Marshal(TitleHeader{
+		Title:    p.Title,
+		Filename: p.Filename,
+		MIME:     p.MIME,
+		Size:     p.Size,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal title header: %w", err)
+	}
+	if header, err = crypt.SealTitle(ks, id, data); err != nil {
+		return "", "", err
+	}
+	if signature, err = crypt.SignTitle(privateKeyB64, header); err != nil {
+		return "", "", err
+	}
+	return header, signature, nil
+}
+
+// OpenTitle decrypts a title header sealed with SealTitle.
+func OpenTitle(ks crypt.KeyStore, id, headerB64 string) (*TitleHeader, error) {
+	data, err := crypt.OpenTitle(ks, id, headerB64)
+	if err != nil {
+		return nil, err
+	}
+	var h TitleHeader
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("invalid title header: %w", err)
+	}
+	return &h, nil
+}
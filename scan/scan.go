@@ -0,0 +1,188 @@
+// Package scan looks for credentials and personal data in a paste before
+// it is published.
+package scan
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kind names what a finding looks like.
+type Kind string
+
+const (
+	AWSAccessKey Kind = "AWS access key"
+	AWSSecretKey Kind = "AWS secret key"
+	GitHubToken  Kind = "GitHub token"
+	SlackToken   Kind = "Slack token"
+	JWT          Kind = "JSON web token"
+	PrivateKey   Kind = "private key"
+	Email        Kind = "email address"
+	HighEntropy  Kind = "high-entropy string"
+)
+
+// Finding is one suspicious span of the scanned text. Start and End are
+// byte offsets, Line and Column are 1-based.
+type Finding struct {
+	Kind   Kind
+	Start  int
+	End    int
+	Line   int
+	Column int
+	Match  string
+}
+
+// Masked shows enough of the match to recognise it without repeating the
+// secret on screen.
+func (f Finding) Masked() string {
+	// runes, so a match with multibyte characters is not cut mid-character
+	first := []rune(strings.SplitN(f.Match, "\n", 2)[0])
+	if len(first) <= 8 {
+		return strings.Repeat("•", len(first))
+	}
+	return string(first[:4]) + "…" + fmt.Sprintf(" (%d chars)", utf8.RuneCountInString(f.Match))
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("line %d, col %d: %s %s", f.Line, f.Column, f.Kind, f.Masked())
+}
+
+type rule struct {
+	kind Kind
+	re   *regexp.Regexp
+	// group selects the submatch holding the secret, 0 for the whole match
+	group int
+}
+
+var rules = []rule{
+	{kind: PrivateKey, re: regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?(-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----|\z)`)},
+	{kind: AWSAccessKey, re: regexp.MustCompile(`\b(AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+	{kind: AWSSecretKey, re: regexp.MustCompile(`(?i)aws.{0,20}?(secret|private)?.{0,10}?key.{0,5}?[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), group: 2},
+	{kind: GitHubToken, re: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{kind: SlackToken, re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{kind: JWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: Email, re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// tokenPattern finds candidates for the entropy check: long runs of the
+// base64 and URL-safe alphabets.
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{24,}={0,2}`)
+
+// entropyThreshold is in bits per character. Random base64 sits around
+// 5.5-6, English words and identifiers stay well below 4.
+const entropyThreshold = 4.3
+
+// Scan returns the findings in text ordered by position. Overlapping
+// matches are reported once, by the most specific rule.
+func Scan(text string) []Finding {
+	var findings []Finding
+	for _, r := range rules {
+		for _, m := range r.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*r.group], m[2*r.group+1]
+			if start < 0 {
+				continue
+			}
+			findings = append(findings, Finding{Kind: r.kind, Start: start, End: end})
+		}
+	}
+	for _, m := range tokenPattern.FindAllStringIndex(text, -1) {
+		if looksRandom(text[m[0]:m[1]]) {
+			findings = append(findings, Finding{Kind: HighEntropy, Start: m[0], End: m[1]})
+		}
+	}
+
+	// rules come before the entropy check, so a stable sort keeps the
+	// specific kind first when two findings start at the same offset
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+
+	kept := findings[:0]
+	lastEnd := -1
+	for _, f := range findings {
+		if f.Start < lastEnd {
+			continue
+		}
+		f.Match = text[f.Start:f.End]
+		f.Line, f.Column = position(text, f.Start)
+		kept = append(kept, f)
+		lastEnd = f.End
+	}
+	return kept
+}
+
+// looksRandom skips hex digests and UUIDs by asking for a mix of upper
+// and lower case letters and digits before measuring entropy.
+func looksRandom(token string) bool {
+	var upper, lower, digit bool
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit && entropy(token) >= entropyThreshold
+}
+
+// entropy is the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+func position(text string, offset int) (line, column int) {
+	before := text[:offset]
+	line = strings.Count(before, "\n") + 1
+	column = offset - strings.LastIndex(before, "\n")
+	return line, column
+}
+
+// Redact replaces every finding with a placeholder naming its kind.
+// findings must come from Scan on the same text.
+func Redact(text string, findings []Finding) string {
+	var b strings.Builder
+	last := 0
+	for _, f := range findings {
+		b.WriteString(text[last:f.Start])
+		b.WriteString("[REDACTED " + strings.ToUpper(string(f.Kind)) + "]")
+		last = f.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Summary counts findings by kind, e.g. "2 AWS access keys, 1 email address".
+func Summary(findings []Finding) string {
+	counts := map[Kind]int{}
+	var order []Kind
+	for _, f := range findings {
+		if counts[f.Kind] == 0 {
+			order = append(order, f.Kind)
+		}
+		counts[f.Kind]++
+	}
+
+	parts := make([]string, len(order))
+	for i, k := range order {
+		parts[i] = fmt.Sprintf("%d %s", counts[k], k)
+		if counts[k] > 1 {
+			parts[i] += "s"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,200 @@
+// Package templates loads Markdown paste templates from the config store's
+// directory and fills in their placeholders.
+//
+// A template is a .md file. An optional front matter block sets the
+// paste title, otherwise the file name is used:
+//
+//	---
+//	title: Incident {{date}}
+//	---
+//	## Impact
+//	{{prompt: Affected service}}
+//
+// {{date}}, {{time}} and {{user}} are filled in automatically.
+// {{prompt: Label}} asks for a value once per label, however often it
+// appears. Anything else in double braces is left alone.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/config"
+)
+
+const templatesDir = "templates"
+
+type Template struct {
+	Name  string
+	Title string
+	Body  string
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*(date|time|user|prompt:\s*([^}]+?))\s*\}\}`)
+
+// Dir returns the template directory of store. The first time it is
+// created it is seeded with the built-in examples, so there is something
+// to start from.
+func Dir(store config.Store) (string, error) {
+	base, err := store.Dir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, templatesDir)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("could not create template directory: %w", err)
+	}
+	for name, body := range examples {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			return "", fmt.Errorf("could not write example template: %w", err)
+		}
+	}
+	return dir, nil
+}
+
+// List returns the templates in dir sorted by name.
+func List(dir string) ([]Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Template
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".md")
+		if !ok || e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, Parse(name, string(data)))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Parse splits the front matter from the body. Only the title key is
+// read, other keys are ignored.
+func Parse(name, data string) Template {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	t := Template{Name: name, Title: name, Body: data}
+
+	rest, ok := strings.CutPrefix(data, "---\n")
+	if !ok {
+		return t
+	}
+	front, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return t
+	}
+	for _, line := range strings.Split(front, "\n") {
+		if v, ok := strings.CutPrefix(line, "title:"); ok {
+			t.Title = strings.TrimSpace(v)
+		}
+	}
+	t.Body = body
+	return t
+}
+
+// Prompts returns the custom prompt labels in the title and body, in the
+// order they first appear.
+func (t Template) Prompts() []string {
+	var labels []string
+	seen := map[string]bool{}
+	for _, m := range placeholder.FindAllStringSubmatch(t.Title+"\n"+t.Body, -1) {
+		label := m[2]
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// Fill replaces the placeholders. answers maps prompt labels to values,
+// prompts without an answer become empty.
+func (t Template) Fill(answers map[string]string, now time.Time) (title, body string) {
+	username := currentUser()
+	replace := func(s string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+			m := placeholder.FindStringSubmatch(match)
+			switch m[1] {
+			case "date":
+				return now.Format("2006-01-02")
+			case "time":
+				return now.Format("15:04")
+			case "user":
+				return username
+			}
+			return answers[m[2]]
+		})
+	}
+	return replace(t.Title), replace(t.Body)
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		// drop the DOMAIN\ prefix on Windows
+		if i := strings.LastIndex(u.Username, `\`); i >= 0 {
+			return u.Username[i+1:]
+		}
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+var examples = map[string]string{
+	"incident.md": `---
+title: Incident {{date}} - {{prompt: Affected service}}
+---
+# Incident report
+
+- **Date:** {{date}} {{time}}
+- **Reported by:** {{user}}
+- **Service:** {{prompt: Affected service}}
+- **Severity:** {{prompt: Severity}}
+
+## Impact
+
+## Timeline
+
+- {{time}} -
+
+## Root cause
+
+## Follow-up actions
+
+- [ ]
+`,
+	"handoff.md": `---
+title: Handoff {{date}} from {{user}}
+---
+# Shift handoff
+
+**From:** {{user}}
+**To:** {{prompt: Handing over to}}
+
+## Ongoing
+
+## Watch out for
+
+## Done this shift
+`,
+}
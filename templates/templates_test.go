@@ -0,0 +1,91 @@
+package templates
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTemplates(t *testing.T) {
+	now := time.Date(2026, 3, 4, 9, 5, 0, 0, time.UTC)
+	user := currentUser()
+
+	tests := []struct {
+		name    string
+		data    string
+		answers map[string]string
+
+		prompts []string
+		title   string
+		body    string
+	}{
+		{
+			name:  "no front matter",
+			data:  "plain {{date}}\n",
+			title: "no front matter",
+			body:  "plain 2026-03-04\n",
+		},
+		{
+			name:  "front matter",
+			data:  "---\ntitle: Notes {{date}}\nauthor: ignored\n---\nby {{user}} at {{time}}\n",
+			title: "Notes 2026-03-04",
+			body:  "by " + user + " at 09:05\n",
+		},
+		{
+			name:  "crlf",
+			data:  "---\r\ntitle: Windows\r\n---\r\nline one\r\nline two\r\n",
+			title: "Windows",
+			body:  "line one\nline two\n",
+		},
+		{
+			name:  "crlf without front matter",
+			data:  "line one\r\nline two\r\n",
+			title: "crlf without front matter",
+			body:  "line one\nline two\n",
+		},
+		{
+			name:  "unclosed front matter",
+			data:  "---\ntitle: never closed\n",
+			title: "unclosed front matter",
+			body:  "---\ntitle: never closed\n",
+		},
+		{
+			name:    "repeated labels",
+			data:    "---\ntitle: {{prompt: Service}} down\n---\n{{prompt: Severity}} {{prompt:Service}} {{ prompt: Severity }}\n",
+			answers: map[string]string{"Service": "api", "Severity": "high"},
+			prompts: []string{"Service", "Severity"},
+			title:   "api down",
+			body:    "high api high\n",
+		},
+		{
+			name:    "unanswered prompts",
+			data:    "owner: {{prompt: Owner}}, eta: {{prompt: ETA}}",
+			answers: map[string]string{"Owner": "sam"},
+			prompts: []string{"Owner", "ETA"},
+			title:   "unanswered prompts",
+			body:    "owner: sam, eta: ",
+		},
+		{
+			name:  "unknown placeholders",
+			data:  "{{ticket}} {{prompt:}} {{date}}",
+			title: "unknown placeholders",
+			body:  "{{ticket}} {{prompt:}} 2026-03-04",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := Parse(tt.name, tt.data)
+			if got := tmpl.Prompts(); !reflect.DeepEqual(got, tt.prompts) {
+				t.Errorf("Prompts() = %q, want %q", got, tt.prompts)
+			}
+			title, body := tmpl.Fill(tt.answers, now)
+			if title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
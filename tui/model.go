@@ -1,14 +1,15 @@
 package tui
 
 import (
-	"os"
+	"context"
+	"errors"
 
 	"Drop-Key-TUI/api"
 	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
 	"Drop-Key-TUI/tui/views"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/x/term"
 )
 
 type viewState int
@@ -28,6 +29,13 @@ type ResizableModel interface {
 
 type MsgSetToken struct{}
 
+// reauthenticatedMsg carries a fresh token obtained after a 401, together
+// with the request that has to be retried with it.
+type reauthenticatedMsg struct {
+	auth  api.AuthResponse
+	retry func(token string) tea.Cmd
+}
+
 type Model struct {
 	state  viewState
 	width  int
@@ -37,16 +45,31 @@ type Model struct {
 	config *config.Config
 	user   api.User
 	views  map[viewState]ResizableModel
+
+	store config.Store
+	keys  crypt.KeyStore
+
+	// ctx covers the background work of a session, key repair and
+	// re-authentication. It is cancelled on logout and quit.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func New() *Model {
+// New builds the root model on top of store, for the identity and the
+// session, and keys, for the paste keys.
+func New(store config.Store, keys crypt.KeyStore) *Model {
 	home := views.NewHomeModel()
-	login := views.NewLoginModel()
-	register := views.NewRegisterModel()
-	dashbord := views.NewDashboardModel()
+	login := views.NewLoginModel(store)
+	register := views.NewRegisterModel(store)
+	dashbord := views.NewDashboardModel(store, keys)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Model{
-		state: homeView,
+		state:  homeView,
+		store:  store,
+		keys:   keys,
+		ctx:    ctx,
+		cancel: cancel,
 		views: map[viewState]ResizableModel{
 			homeView:         home,
 			registrationView: register,
@@ -56,16 +79,89 @@ func New() *Model {
 	}
 }
 
+// Init waits for the tea.WindowSizeMsg Bubble Tea sends at startup to lay
+// anything out, the terminal is never queried directly.
 func (m *Model) Init() tea.Cmd {
-	physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
-	m.width = physicalWidth
-	m.height = physicalHeight
-	m.views[m.state].SetSize(physicalWidth, physicalHeight)
+	if cmd := m.resumeSession(); cmd != nil {
+		return cmd
+	}
 	return m.views[m.state].Init()
 }
 
+// resumeSession skips the login screen when a previous run left a token
+// that has not expired yet.
+func (m *Model) resumeSession() tea.Cmd {
+	token, err := m.store.LoadToken()
+	if err != nil || !token.Valid() {
+		return nil
+	}
+	cfg, err := m.store.Load()
+	if err != nil {
+		return nil
+	}
+	return func() tea.Msg {
+		return views.LoginSuccessMsg{
+			Token:     token.Value,
+			ExpiresAt: token.ExpiresAt,
+			User:      api.User{PublicKey: cfg.PublicKey},
+		}
+	}
+}
+
+// reauthCmd signs a new challenge and hands the fresh token to the retry.
+// A second 401 after re-authenticating is reported as an error instead of
+// looping forever.
+func reauthCmd(ctx context.Context, store config.Store, retry func(token string) tea.Cmd) tea.Cmd {
+	return func() tea.Msg {
+		userID, err := store.LoadUserID()
+		if err != nil {
+			return api.ErrMsg(api.ErrUnauthorized)
+		}
+
+		switch msg := views.Authenticate(ctx, store, userID)().(type) {
+		case api.AuthResponse:
+			return reauthenticatedMsg{
+				auth: msg,
+				retry: func(token string) tea.Cmd {
+					return func() tea.Msg {
+						result := retry(token)()
+						if _, ok := result.(api.UnauthorizedMsg); ok {
+							return api.ErrMsg(api.ErrUnauthorized)
+						}
+						return result
+					}
+				},
+			}
+		case error:
+			return api.ErrMsg(msg)
+		default:
+			return api.ErrMsg(api.ErrUnauthorized)
+		}
+	}
+}
+
+// leave cancels the requests of the session and of the current view
+func (m *Model) leave() {
+	m.cancel()
+	if v, ok := m.views[m.state].(interface{ Leave() }); ok {
+		v.Leave()
+	}
+}
+
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		// every view quits on ctrl+c, nothing in flight is waited for
+		if msg.String() == "ctrl+c" {
+			m.leave()
+		}
+
+	case api.ErrMsg:
+		// whoever cancelled the request has already moved on
+		if errors.Is(msg, api.ErrCanceled) {
+			return m, nil
+		}
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -77,40 +173,56 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case views.RegisterSelectedMsg:
 		m.state = registrationView
 		m.views[registrationView].SetSize(m.width, m.height)
-		physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
-		m.views[m.state].SetSize(physicalWidth, physicalHeight)
 		return m, m.views[registrationView].Init()
 
 	case views.RegistrationSuccessMsg:
 		m.state = loginView
-		physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
-		m.views[m.state].SetSize(physicalWidth, physicalHeight)
-		config.SaveUserID(msg.ID)
+		m.views[m.state].SetSize(m.width, m.height)
+		m.store.SaveUserID(msg.ID)
 		return m, m.views[loginView].Init()
 
 	case views.LoginSelectedMsg:
 		m.state = loginView
-		physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
-		m.views[m.state].SetSize(physicalWidth, physicalHeight)
+		m.views[m.state].SetSize(m.width, m.height)
 		return m, m.views[loginView].Init()
 
 	case views.LoginSuccessMsg:
 		m.token = msg.Token
 		m.user = msg.User
+		m.store.SaveToken(config.Token{Value: msg.Token, ExpiresAt: msg.ExpiresAt})
 		m.state = dashbordView
 		m.views[m.state].SetSize(m.width, m.height)
 		return m, tea.Batch(
 			m.views[dashbordView].Init(),
-			func() tea.Msg {
-				return tea.WindowSizeMsg{Width: m.width, Height: m.height}
-			},
 			func() tea.Msg {
 				return MsgSetToken{}
 			},
+			views.RepairKeysCmd(m.ctx, m.store, m.keys),
 		)
 
+	case api.UnauthorizedMsg:
+		return m, reauthCmd(m.ctx, m.store, msg.Retry)
+
+	case reauthenticatedMsg:
+		m.token = msg.auth.Token
+		m.store.SaveToken(config.Token{Value: msg.auth.Token, ExpiresAt: msg.auth.Expiry()})
+		m.views[dashbordView].SetToken(m.token)
+		return m, msg.retry(m.token)
+
+	case views.LogoutMsg:
+		m.leave()
+		m.ctx, m.cancel = context.WithCancel(context.Background())
+		m.store.ClearUserID()
+		m.token = ""
+		m.user = api.User{}
+		m.state = homeView
+		m.views[dashbordView] = views.NewDashboardModel(m.store, m.keys)
+		m.views[dashbordView].SetSize(m.width, m.height)
+		m.views[m.state].SetSize(m.width, m.height)
+		return m, m.views[homeView].Init()
+
 	case views.RequestUserIDMsg:
-		userID, err := config.LoadUserID()
+		userID, err := m.store.LoadUserID()
 		if err != nil {
 			return m, func() tea.Msg {
 				return err
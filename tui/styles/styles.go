@@ -83,3 +83,13 @@ var SpinnerStyle = lipgloss.NewStyle().
 var ErrorStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.Color("9")).
 	Bold(true)
+
+var (
+	TrustedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("42")).
+			Bold(true)
+
+	UntrustedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")).
+			Bold(true)
+)
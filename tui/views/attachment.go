@@ -0,0 +1,51 @@
+package views
+
+import (
+	"path/filepath"
+	"strings"
+
+	"Drop-Key-TUI/paste"
+	"Drop-Key-TUI/tui/styles"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type attachmentSavedMsg struct {
+	path string
+	err  error
+}
+
+// saveAttachmentCmd writes an attachment to the download directory
+func saveAttachmentCmd(p *paste.Payload) tea.Cmd {
+	return func() tea.Msg {
+		dir, err := paste.DownloadDir()
+		if err != nil {
+			return attachmentSavedMsg{err: err}
+		}
+		path, err := p.Save(dir)
+		return attachmentSavedMsg{path: path, err: err}
+	}
+}
+
+// attachmentCard is shown in place of content that cannot be rendered
+func attachmentCard(p *paste.Payload) string {
+	return styles.MetaStyle.Render("📎 "+p.Describe()) + "\n\n" +
+		styles.SubtleStyle.Render("This attachment is not text, press Ctrl+O to save it to disk.")
+}
+
+func (m attachmentSavedMsg) notice() string {
+	if m.err != nil {
+		return "✘ could not save attachment: " + m.err.Error()
+	}
+	return "Saved to " + m.path
+}
+
+// renderableText returns the markdown the viewers hand to glamour. Text
+// attachments are fenced so source files are not rendered as markdown.
+func renderableText(p *paste.Payload) string {
+	if !p.IsAttachment() {
+		return string(p.Body)
+	}
+	lang := strings.TrimPrefix(filepath.Ext(p.Filename), ".")
+	return "```" + lang + "\n" + string(p.Body) + "\n```"
+}
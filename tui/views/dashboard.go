@@ -3,6 +3,9 @@ package views
 import (
 	"strings"
 
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
 	"Drop-Key-TUI/tui/styles"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,6 +18,7 @@ const (
 	TabCreate DashboardTab = iota
 	TabYourPastes
 	TabSearch
+	TabSettings
 	tabCount
 )
 
@@ -62,21 +66,55 @@ type DashboardModel struct {
 	width, height int
 }
 
+// LogoutMsg asks the root model to clear the session and go back home.
+type LogoutMsg struct{}
+
+// DashboardTabView is a tab of the dashboard. SetSize gets the terminal
+// size whenever it changes, including for tabs that are not showing, so a
+// tab is laid out correctly the moment it is switched to.
 type DashboardTabView interface {
 	tea.Model
 	Title() string
+	SetSize(width, height int)
 }
 
 func (m *DashboardModel) SetToken(token string) {
 	m.token = token
+	for _, tab := range m.availableTabs {
+		if t, ok := tab.(interface{ SetToken(string) }); ok {
+			t.SetToken(token)
+		}
+	}
+}
+
+// leaveTab lets the active tab stop background work before another tab
+// is shown. Uploads in the Create tab keep going.
+func (m *DashboardModel) leaveTab() {
+	if m.activeTab == TabCreate {
+		return
+	}
+	if t, ok := m.availableTabs[m.activeTab].(interface{ Leave() }); ok {
+		t.Leave()
+	}
 }
 
-func NewDashboardModel() *DashboardModel {
+// Leave stops every tab on logout and quit, an upload running in the
+// background included
+func (m *DashboardModel) Leave() {
+	for _, tab := range m.availableTabs {
+		if t, ok := tab.(interface{ Leave() }); ok {
+			t.Leave()
+		}
+	}
+}
+
+func NewDashboardModel(store config.Store, keys crypt.KeyStore) *DashboardModel {
 	return &DashboardModel{
 		availableTabs: map[DashboardTab]DashboardTabView{
-			TabCreate:     NewPasteFormModel(),
-			TabYourPastes: NewPasteListModel(),
-			TabSearch:     NewSearchModel(),
+			TabCreate:     NewPasteFormModel(store, keys),
+			TabYourPastes: NewPasteListModel(store, keys),
+			TabSearch:     NewSearchModel(store, keys),
+			TabSettings:   NewSettingsModel(store, keys),
 		},
 	}
 }
@@ -84,6 +122,9 @@ func NewDashboardModel() *DashboardModel {
 func (m *DashboardModel) SetSize(width, height int) {
 	m.height = height
 	m.width = width
+	for _, tab := range m.availableTabs {
+		tab.SetSize(width, height)
+	}
 }
 
 func (m *DashboardModel) Init() tea.Cmd {
@@ -95,13 +136,20 @@ func (m *DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "tab":
+			m.leaveTab()
 			m.activeTab = (m.activeTab + 1) % tabCount
 			return m, m.availableTabs[m.activeTab].Init()
 
 		case "shift+tab":
+			m.leaveTab()
 			m.activeTab = (m.activeTab - 1 + tabCount) % tabCount
 			return m, m.availableTabs[m.activeTab].Init()
 
+		case "ctrl+x":
+			return m, func() tea.Msg {
+				return LogoutMsg{}
+			}
+
 		case "ctrl+c":
 			return m, tea.Quit
 		}
@@ -110,6 +158,19 @@ func (m *DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, func() tea.Msg {
 			return responseToken{token: m.token}
 		}
+
+	case KeysRepairedMsg:
+		// shown on the list whichever tab is open
+		updated, cmd := m.availableTabs[TabYourPastes].Update(msg)
+		m.availableTabs[TabYourPastes] = updated.(DashboardTabView)
+		return m, cmd
+
+	case api.PasteCreatedMsg, api.PasteCreateFailedMsg:
+		// uploads keep going when the user switches tabs, the form still
+		// has to move the key to the paste ID or report the failure
+		updated, cmd := m.availableTabs[TabCreate].Update(msg)
+		m.availableTabs[TabCreate] = updated.(DashboardTabView)
+		return m, cmd
 	}
 	tab := m.availableTabs[m.activeTab]
 	updatedTab, cmd := tab.Update(msg)
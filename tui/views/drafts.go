@@ -0,0 +1,86 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/drafts"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// draftInterval is how often the paste form checks for unsaved changes
+const draftInterval = 3 * time.Second
+
+type (
+	// draftTickMsg carries the generation of the tick loop that sent it,
+	// so reopening the tab does not start a second loop
+	draftTickMsg struct {
+		gen int
+	}
+	draftSavedMsg struct {
+		at  time.Time
+		err error
+	}
+	draftsLoadedMsg struct {
+		list []drafts.Draft
+		err  error
+	}
+	draftDeletedMsg struct {
+		err error
+	}
+)
+
+// formSnapshot is what alt+c and alt+n throw away, kept for alt+u
+type formSnapshot struct {
+	title   string
+	body    string
+	draftID string
+}
+
+type draftItem struct {
+	drafts.Draft
+}
+
+func (d draftItem) Title() string {
+	if d.Draft.Title == "" {
+		return "Untitled"
+	}
+	return d.Draft.Title
+}
+
+func (d draftItem) Description() string {
+	first, _, _ := strings.Cut(strings.TrimSpace(d.Body), "\n")
+	if len(first) > 40 {
+		first = first[:40] + "…"
+	}
+	return fmt.Sprintf("%s · %s", d.UpdatedAt.Local().Format("Jan 2 15:04"), first)
+}
+
+func (d draftItem) FilterValue() string { return d.Draft.Title }
+
+func draftTick(gen int) tea.Cmd {
+	return tea.Tick(draftInterval, func(time.Time) tea.Msg {
+		return draftTickMsg{gen: gen}
+	})
+}
+
+func saveDraftCmd(store *drafts.Store, d drafts.Draft) tea.Cmd {
+	return func() tea.Msg {
+		return draftSavedMsg{at: d.UpdatedAt, err: store.Save(d)}
+	}
+}
+
+func loadDraftsCmd(store *drafts.Store) tea.Cmd {
+	return func() tea.Msg {
+		list, err := store.List()
+		return draftsLoadedMsg{list: list, err: err}
+	}
+}
+
+func deleteDraftCmd(store *drafts.Store, id string) tea.Cmd {
+	return func() tea.Msg {
+		return draftDeletedMsg{err: store.Delete(id)}
+	}
+}
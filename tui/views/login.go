@@ -1,13 +1,16 @@
 package views
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
 	"Drop-Key-TUI/api"
 	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/tui/styles"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -31,11 +34,14 @@ type Model struct {
 	height        int
 	err           error
 	token         string
+	store         config.Store
+	req           inflight
 }
 
 type LoginSuccessMsg struct {
-	Token string
-	User  api.User
+	Token     string
+	ExpiresAt time.Time
+	User      api.User
 }
 
 type AuthErrorMsg struct {
@@ -53,12 +59,13 @@ func (m *Model) SetSize(width, height int) {
 	m.height = height
 }
 
-func NewLoginModel() *Model {
+func NewLoginModel(store config.Store) *Model {
 	s := spinner.New()
 	s.Spinner = spinner.Monkey
 	return &Model{
 		CurrentState: requestingUserID,
 		Spinner:      s,
+		store:        store,
 	}
 }
 
@@ -79,7 +86,20 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q":
+			m.req.stop()
 			return m, tea.Quit
+		case "esc":
+			if m.CurrentState == authenticating {
+				m.req.stop()
+				m.CurrentState = err
+				m.err = api.ErrCanceled
+				return m, nil
+			}
+		case "enter":
+			if m.CurrentState == err {
+				m.CurrentState = requestingUserID
+				return m, m.Init()
+			}
 		}
 
 	case api.ErrMsg:
@@ -88,15 +108,17 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case api.AuthResponse:
+		m.req.stop()
 		m.CurrentState = done
-		config, err := config.Load()
+		config, err := m.store.Load()
 		if err != nil {
 			return m, func() tea.Msg {
 				return AuthErrorMsg{err: err}
 			}
 		}
 		successMsg := LoginSuccessMsg{
-			Token: msg.Token,
+			Token:     msg.Token,
+			ExpiresAt: msg.Expiry(),
 			User: api.User{
 				PublicKey: config.PublicKey,
 			},
@@ -106,6 +128,11 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return successMsg
 		}
 
+	case AuthErrorMsg:
+		m.CurrentState = err
+		m.err = msg.err
+		return m, nil
+
 	case error:
 		m.CurrentState = err
 		m.err = msg
@@ -131,10 +158,10 @@ func (m *Model) SetToken(token string) {
 
 func (m *Model) View() string {
 	if m.CurrentState == authenticating {
-		return "Authenticating..." + m.Spinner.View()
+		return "Authenticating..." + m.Spinner.View() + m.req.retrying() + "\n" + styles.HelpStyle.Render("esc to cancel")
 	}
 	if m.CurrentState == err {
-		return fmt.Sprint("Error during authentication, error : %w", m.err)
+		return fmt.Sprintf("Error during authentication: %s", describeAuthError(m.err)) + "\n" + styles.HelpStyle.Render("enter to try again | q to quit")
 	}
 	if m.CurrentState == requestingUserID {
 		return fmt.Sprintf("Getting user ID...")
@@ -142,8 +169,38 @@ func (m *Model) View() string {
 	return fmt.Sprintf("Authentication done")
 }
 
+// describeAuthError explains the typed login failures in terms the user
+// can act on, and falls back to the raw error for anything else.
+func describeAuthError(e error) string {
+	switch {
+	case errors.Is(e, api.ErrClockSkew):
+		return "your system clock is too far off from the server, please sync it and try again"
+	case errors.Is(e, api.ErrInvalidNonce):
+		return "the login challenge expired or was already used, please try again"
+	case errors.Is(e, api.ErrBadSignature):
+		return "the server rejected the signature, check that this key is the one you registered"
+	case errors.Is(e, api.ErrCanceled):
+		return "login cancelled"
+	case errors.Is(e, api.ErrTimeout):
+		return "the server did not answer in time, check your connection and try again"
+	}
+	return e.Error()
+}
+
 func (m *Model) authCmd(id string) tea.Cmd {
-	config, err := config.Load()
+	return Authenticate(m.req.start(), m.store, id)
+}
+
+// Leave cancels a login still in progress
+func (m *Model) Leave() {
+	m.req.stop()
+}
+
+// Authenticate signs a fresh challenge with the stored private key and
+// exchanges it for a bearer token. It is also used to re-authenticate
+// transparently when a token expires mid-session.
+func Authenticate(ctx context.Context, store config.Store, id string) tea.Cmd {
+	config, err := store.Load()
 	if err != nil {
 		return func() tea.Msg {
 			return AuthErrorMsg{err: err}
@@ -156,18 +213,21 @@ func (m *Model) authCmd(id string) tea.Cmd {
 		}
 	}
 
-	challengeString := time.Now().UTC().Format(time.RFC3339)
-	challengeB64 := base64.StdEncoding.EncodeToString([]byte(challengeString))
-
-	signatureBytes := ed25519.Sign(privKeyBytes, []byte(challengeString))
-	signatureB64 := base64.StdEncoding.EncodeToString(signatureBytes)
+	return func() tea.Msg {
+		msg := api.RequestChallenge(ctx, id)()
+		challenge, ok := msg.(api.ChallengeMsg)
+		if !ok {
+			return msg
+		}
 
-	authCmd := api.AuthenticateUser(api.AuthRequest{
-		ID:        id,
-		PublicKey: config.PublicKey,
-		Signature: signatureB64,
-		Challenge: challengeB64,
-	})
+		signatureBytes := ed25519.Sign(privKeyBytes, api.ChallengeMessage(id, challenge.Nonce))
+		signatureB64 := base64.StdEncoding.EncodeToString(signatureBytes)
 
-	return authCmd
+		return api.AuthenticateUser(ctx, api.AuthRequest{
+			ID:        id,
+			PublicKey: config.PublicKey,
+			Signature: signatureB64,
+			Challenge: challenge.Nonce,
+		})()
+	}
 }
@@ -1,24 +1,26 @@
 package views
 
 import (
-	"crypto/ed25519"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"os"
+	"time"
 
 	"Drop-Key-TUI/api"
 	"Drop-Key-TUI/config"
 	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/drafts"
+	"Drop-Key-TUI/paste"
+	"Drop-Key-TUI/scan"
+	"Drop-Key-TUI/templates"
 	"Drop-Key-TUI/tui/styles"
 
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/x/term"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/glamour"
-	"github.com/google/uuid"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -31,6 +33,12 @@ const (
 	selectingExpiry formState = "selecting expiry"
 	formErr         formState = "form error"
 	pastecreated    formState = "paste created successfully"
+	attachingFile   formState = "attaching file"
+	reviewingScan   formState = "reviewing scan findings"
+	pickingDraft    formState = "picking draft"
+	pickingTemplate formState = "picking template"
+	fillingTemplate formState = "filling template"
+	publishingPaste formState = "publishing paste"
 )
 
 type PasteFormModel struct {
@@ -38,6 +46,10 @@ type PasteFormModel struct {
 	textarea     textarea.Model
 	titleBar     textarea.Model
 	viewport     viewport.Model
+	fileInput    textinput.Model
+	draftList    list.Model
+	templateList list.Model
+	promptInput  textinput.Model
 
 	viewportActive  bool
 	selectingExpiry bool
@@ -52,6 +64,41 @@ type PasteFormModel struct {
 	token    string
 	title    string
 
+	// attachment replaces the textarea contents when set
+	attachment *paste.Payload
+
+	// findings from the pre-submit secret scan
+	findings []scan.Finding
+
+	// drafts is nil when the store could not be opened, which turns
+	// autosave off
+	drafts      *drafts.Store
+	draftID     string
+	draftSaved  string
+	draftNotice string
+	tickGen     int
+	// publishing is the draft to delete once the server accepts the paste
+	publishing string
+	undo       *formSnapshot
+
+	// template being filled in, with the prompts still to ask
+	template       *templates.Template
+	prompts        []string
+	answers        map[string]string
+	templateReturn formState
+	templateDir    string
+	// templateBody goes into the textarea once the title is confirmed
+	templateBody string
+
+	store config.Store
+	keys  crypt.KeyStore
+
+	// spinner and req belong to the upload while publishingPaste,
+	// uploadID is the temp ID it was sealed under
+	spinner  spinner.Model
+	req      inflight
+	uploadID string
+
 	err    bool
 	ErrMsg string
 }
@@ -65,46 +112,80 @@ type (
 	pasteCreateError struct {
 		err string
 	}
-
-	cipherTextPayload struct {
-		Title string `json:"title"`
-		Paste string `json:"paste"`
-	}
 )
 
-func NewPasteFormModel() *PasteFormModel {
-	physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
+func NewPasteFormModel(store config.Store, keys crypt.KeyStore) *PasteFormModel {
 	ta := textarea.New()
 	ta.Placeholder = "Type your paste here..."
 	ta.Focus()
 	ta.ShowLineNumbers = false
 	ta.CharLimit = 0
-	ta.SetWidth(physicalWidth - 18)
-	ta.SetHeight(physicalHeight - 14)
 	ta.BlurredStyle.Placeholder = lipgloss.NewStyle().Foreground(lipgloss.Color("213"))
 	ta.FocusedStyle.Placeholder = lipgloss.NewStyle().Foreground(lipgloss.Color("000"))
 
-	vp := viewport.New(physicalWidth-18, physicalHeight-12)
+	vp := viewport.New(0, 0)
 	vp.Style = styles.VpStyle
 
 	titleBar := textarea.New()
 	titleBar.Focus()
 	titleBar.ShowLineNumbers = false
 	titleBar.CharLimit = 40
-	titleBar.SetWidth(physicalWidth - 28)
 	titleBar.SetHeight(2)
 	titleBar.BlurredStyle.Placeholder = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
 	titleBar.FocusedStyle.Placeholder = lipgloss.NewStyle().Foreground(lipgloss.Color("213"))
 
+	fileInput := textinput.New()
+	fileInput.Placeholder = "Path of the file to attach"
+	fileInput.Width = 50
+
+	draftList := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	draftList.Title = "Unpublished drafts"
+	draftList.SetShowStatusBar(false)
+	draftList.SetShowHelp(false)
+	draftList.SetFilteringEnabled(false)
+	draftList.Styles.Title = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("218"))
+
+	templateList := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	templateList.Title = "New from template"
+	templateList.SetShowStatusBar(false)
+	templateList.SetShowHelp(false)
+	templateList.SetFilteringEnabled(false)
+	templateList.Styles.Title = draftList.Styles.Title
+
+	promptInput := textinput.New()
+	promptInput.Width = 50
+
+	s := spinner.New()
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+
 	return &PasteFormModel{
 		currentState: decidingTitle,
 		textarea:     ta,
 		titleBar:     titleBar,
 		viewport:     vp,
+		fileInput:    fileInput,
+		draftList:    draftList,
+		templateList: templateList,
+		promptInput:  promptInput,
+		spinner:      s,
+		store:        store,
+		keys:         keys,
 		pasteCreated: false,
 	}
 }
 
+func (m *PasteFormModel) SetSize(width, height int) {
+	m.width = width
+	m.height = height
+	m.textarea.SetWidth(max(width-18, 1))
+	m.textarea.SetHeight(max(height-14, 1))
+	m.titleBar.SetWidth(max(width-28, 1))
+	m.viewport.Width = max(width-18, 1)
+	m.viewport.Height = max(height-12, 1)
+	m.draftList.SetSize(max(width-18, 1), max(height-12, 1))
+	m.templateList.SetSize(max(width-18, 1), max(height-12, 1))
+}
+
 func (m *PasteFormModel) UpdateViewportContent() {
 	const glamourGutter = 2
 	vpWidth := m.viewport.Width
@@ -129,11 +210,37 @@ func (m *PasteFormModel) UpdateViewportContent() {
 }
 
 func (m *PasteFormModel) Init() tea.Cmd {
-	return tea.Batch(m.titleBar.Cursor.BlinkCmd(),
+	cmds := []tea.Cmd{
+		m.titleBar.Cursor.BlinkCmd(),
 		func() tea.Msg {
 			return requestToken{}
 		},
-	)
+	}
+	if m.currentState == publishingPaste {
+		// the tick chain ended when the user switched tabs
+		cmds = append(cmds, m.spinner.Tick)
+	}
+	if m.drafts == nil {
+		// the drafts key is wrapped under the identity, which only exists
+		// once the user registered. Without it the form works as before
+		// and says why nothing is saved.
+		store, err := drafts.Open(m.store)
+		if err != nil {
+			m.draftNotice = "Drafts are off: " + err.Error()
+		} else {
+			m.drafts, m.draftNotice = store, ""
+		}
+	}
+	if m.drafts != nil {
+		m.tickGen++
+		cmds = append(cmds, draftTick(m.tickGen))
+
+		// only offer drafts before anything has been typed
+		if m.currentState == decidingTitle && m.draftContent() == "\x00" {
+			cmds = append(cmds, loadDraftsCmd(m.drafts))
+		}
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m *PasteFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -141,6 +248,18 @@ func (m *PasteFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.currentState == publishingPaste {
+			// the key stays under the temporary ID, if the server did
+			// create the paste it is recovered at the next login
+			if msg.String() == "esc" {
+				m.req.stop()
+				m.uploadID = ""
+				m.publishing = ""
+				m.currentState = writingPaste
+				m.draftNotice = "Upload cancelled"
+			}
+			return m, nil
+		}
 		if m.currentState == pastecreated {
 			m.currentState = writingPaste
 			return m, nil
@@ -149,6 +268,21 @@ func (m *PasteFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.currentState = writingPaste
 			return m, nil
 		}
+		if m.currentState == attachingFile {
+			return m.updateFileInput(msg)
+		}
+		if m.currentState == reviewingScan {
+			return m.updateScanReview(msg)
+		}
+		if m.currentState == pickingDraft {
+			return m.updateDraftPicker(msg)
+		}
+		if m.currentState == pickingTemplate {
+			return m.updateTemplatePicker(msg)
+		}
+		if m.currentState == fillingTemplate {
+			return m.updateTemplatePrompt(msg)
+		}
 
 		switch msg.String() {
 		case "enter":
@@ -156,7 +290,8 @@ func (m *PasteFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.title = m.titleBar.Value()
 				m.titleBar.SetValue("")
 				m.currentState = writingPaste
-				m.textarea.SetValue("")
+				m.textarea.SetValue(m.templateBody)
+				m.templateBody = ""
 				return m, nil
 			}
 		case "esc":
@@ -187,6 +322,11 @@ func (m *PasteFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+s":
 			if m.currentState == writingPaste {
 				m.textarea.Blur()
+				m.findings = scan.Scan(m.scanTarget())
+				if len(m.findings) > 0 {
+					m.currentState = reviewingScan
+					return m, nil
+				}
 				m.currentState = selectingExpiry
 				return m, nil
 			}
@@ -194,34 +334,167 @@ func (m *PasteFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "1", "2", "3", "4", "5", "6", "7":
 			if m.currentState == selectingExpiry {
 				m.expiryDays = int(msg.Runes[0]-'0') * 86400
-				paste := m.textarea.Value()
-				return m, m.CreatePaste(paste, m.title, m.token, m.expiryDays)
+				m.publishing = m.draftID
+				payload := m.attachment
+				if payload == nil {
+					payload = paste.Text(m.title, m.textarea.Value())
+				}
+				m.currentState = publishingPaste
+				return m, tea.Batch(m.CreatePaste(payload, m.token, m.expiryDays), m.spinner.Tick)
+			}
+
+		case "alt+a":
+			if m.currentState == writingPaste {
+				m.textarea.Blur()
+				m.fileInput.SetValue("")
+				m.fileInput.Focus()
+				m.currentState = attachingFile
+				return m, textinput.Blink
+			}
+
+		case "alt+d":
+			if m.currentState == writingPaste && m.attachment != nil {
+				m.attachment = nil
+				m.textarea.Focus()
+				return m, nil
 			}
 
 		case "alt+c":
 			if m.currentState == writingPaste {
+				m.keepUndo()
 				m.textarea.SetValue("")
 				return m, nil
 			}
 
 		case "alt+n":
 			if m.currentState == writingPaste {
+				// the old draft stays on disk, the next one gets a new ID
+				m.keepUndo()
 				m.currentState = decidingTitle
 				m.textarea.SetValue("")
 				m.titleBar.SetValue("")
+				m.attachment = nil
+				m.draftID = ""
 				return m, nil
 			}
+
+		case "alt+t":
+			if m.currentState == writingPaste || m.currentState == decidingTitle {
+				m.textarea.Blur()
+				m.templateReturn = m.currentState
+				return m, loadTemplatesCmd(m.store)
+			}
+
+		case "alt+u":
+			if m.undo != nil && (m.currentState == writingPaste || m.currentState == decidingTitle) {
+				m.title = m.undo.title
+				m.textarea.SetValue(m.undo.body)
+				m.draftID = m.undo.draftID
+				m.undo = nil
+				m.titleBar.SetValue("")
+				m.textarea.Focus()
+				m.currentState = writingPaste
+				return m, nil
+			}
+		}
+
+	case draftTickMsg:
+		if msg.gen != m.tickGen {
+			return m, nil
+		}
+		return m, tea.Batch(m.autosave(), draftTick(m.tickGen))
+
+	case draftSavedMsg:
+		if msg.err != nil {
+			m.draftNotice = "Draft not saved: " + msg.err.Error()
+		} else {
+			m.draftNotice = "Draft saved at " + msg.at.Format("15:04:05")
+		}
+		return m, nil
+
+	case draftDeletedMsg:
+		if msg.err != nil {
+			m.draftNotice = "Draft not deleted: " + msg.err.Error()
+		}
+		return m, nil
+
+	case templatesLoadedMsg:
+		if msg.err != nil {
+			m.currentState = formErr
+			m.ErrMsg = "Could not load templates: " + msg.err.Error()
+			return m, nil
+		}
+		items := make([]list.Item, len(msg.list))
+		for i, t := range msg.list {
+			items[i] = templateItem{t}
+		}
+		m.templateDir = msg.dir
+		m.templateList.SetItems(items)
+		m.templateList.Select(0)
+		m.currentState = pickingTemplate
+		return m, nil
+
+	case draftsLoadedMsg:
+		if msg.err != nil || len(msg.list) == 0 || m.currentState != decidingTitle {
+			return m, nil
+		}
+		items := make([]list.Item, len(msg.list))
+		for i, d := range msg.list {
+			items[i] = draftItem{d}
+		}
+		m.draftList.SetItems(items)
+		m.draftList.Select(0)
+		m.currentState = pickingDraft
+		return m, nil
+
+	case spinner.TickMsg:
+		if m.currentState == publishingPaste {
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
 		}
 
 	case api.PasteCreatedMsg:
+		if m.currentState != publishingPaste || msg.TempID != m.uploadID {
+			// an upload that was cancelled, or started before a logout,
+			// its key is recovered at the next login
+			return m, nil
+		}
+		m.req.stop()
+		m.uploadID = ""
 		m.pasteUrl = msg.URL
 		m.pasteID = msg.ID
 		m.currentState = pastecreated
+		m.attachment = nil
+
+		// what was just published is not a draft any more, anything typed
+		// after this starts a new one
+		cmds := []tea.Cmd{remapTempIdCmd(m.keys, msg.TempID, msg.CreatePasteResponse.ID)}
+		if m.drafts != nil && m.publishing != "" {
+			cmds = append(cmds, deleteDraftCmd(m.drafts, m.publishing))
+		}
+		if m.draftID == m.publishing {
+			m.draftID = ""
+			m.draftSaved = m.draftContent()
+		}
+		m.publishing = ""
+		m.draftNotice = ""
 
 		// remap tempID -> actualID
-		return m, remapTempIdCmd(msg.TempID, msg.CreatePasteResponse.ID)
+		return m, tea.Batch(cmds...)
+
+	case api.PasteCreateFailedMsg:
+		if m.currentState != publishingPaste || msg.TempID != m.uploadID {
+			return m, nil
+		}
+		m.req.stop()
+		m.uploadID = ""
+		m.publishing = ""
+		m.currentState = formErr
+		m.ErrMsg = msg.Error()
+		return m, nil
 
 	case api.ErrMsg:
+		m.req.stop()
 		m.currentState = formErr
 		m.ErrMsg = msg.Error()
 		return m, nil
@@ -245,26 +518,59 @@ func (m *PasteFormModel) View() string {
 	switch m.currentState {
 
 	case decidingTitle:
-		_, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
 		out += styles.HeaderStyle.Render("📝 Enter a title for your paste:")
 		out += "\n"
 		out += m.titleBar.View()
-		out += styles.HelpStyle.PaddingTop(physicalHeight - 14).Render("tab to switch tabs | Ctrl+C to quit")
+		if m.draftNotice != "" {
+			out += "\n" + styles.SubtleStyle.Render(m.draftNotice)
+		}
+		out += styles.HelpStyle.PaddingTop(max(m.height-14, 0)).Render("Alt+T new from template | tab to switch tabs | Ctrl+X to logout | Ctrl+C to quit")
 
 	case writingPaste:
-		if m.viewportActive {
+		if m.attachment != nil {
+			out += "\n"
+			out += styles.MetaStyle.Render("📎 " + m.attachment.Describe())
+			out += "\n" + styles.SubtleStyle.Render("The file is sent instead of the editor contents, Alt+D to remove it.")
+		} else if m.viewportActive {
 			m.UpdateViewportContent()
 			out += m.viewport.View()
 		} else {
 			out += "\n"
 			out += m.textarea.View()
 		}
+		if m.draftNotice != "" {
+			out += "\n" + styles.SubtleStyle.Render(m.draftNotice)
+		}
 		out += "\n" + m.renderHelp()
 
+	case attachingFile:
+		out += styles.HeaderStyle.Render("📎 Attach a file")
+		out += "\n\n" + m.fileInput.View()
+		out += "\n" + styles.HelpStyle.Render(fmt.Sprintf("Enter to attach (up to %d MiB) | esc to cancel", paste.MaxSize>>20))
+
+	case reviewingScan:
+		out += m.renderFindings()
+
+	case pickingTemplate:
+		out += m.templateList.View()
+		out += "\n" + styles.SubtleStyle.Render("Add your own as Markdown files in "+m.templateDir)
+		out += "\n" + styles.HelpStyle.Render("Enter to use a template | esc to go back")
+
+	case fillingTemplate:
+		out += m.renderTemplatePrompt()
+
+	case pickingDraft:
+		out += m.draftList.View()
+		out += "\n" + styles.HelpStyle.Render("Enter to continue a draft | d delete | n or esc to start a new paste")
+
 	case selectingExpiry:
 		out += styles.HeaderStyle.Render("⏳ Select expiry (1–7 days):\n")
 		out += styles.HelpStyle.Render("Use number keys to choose expiry")
 
+	case publishingPaste:
+		out += fmt.Sprintf("%s %s\n", m.spinner.View(), styles.SubtleStyle.Render("Publishing paste..."+m.req.retrying()))
+		out += styles.HelpStyle.Render("esc to cancel")
+
 	case pastecreated:
 		urlStyle := lipgloss.NewStyle().
 			Foreground(lipgloss.Color("81")).
@@ -275,7 +581,19 @@ func (m *PasteFormModel) View() string {
 		id := urlStyle.Render(fmt.Sprintf("🔗 Paste ID: %v", m.pasteID))
 		help := styles.HelpStyle.Render("Press any key to continue...")
 
-		out += lipgloss.JoinVertical(lipgloss.Left, res, id, help)
+		// the link is what a phone wants, fall back to the bare ID when the
+		// server did not send one
+		share := m.pasteUrl
+		if share == "" {
+			share = m.pasteID
+		}
+		code := qrOrHint(share, m.width-4, m.height-14)
+
+		out += lipgloss.JoinVertical(lipgloss.Left, res, id, "", code, help)
+		if m.draftNotice != "" {
+			// the draft of the paste could not be deleted
+			out += "\n" + styles.SubtleStyle.Render(m.draftNotice)
+		}
 
 	case formErr:
 		err := styles.ErrStyle.Render("✘ " + m.ErrMsg)
@@ -289,72 +607,213 @@ func (m *PasteFormModel) View() string {
 	return out
 }
 
-// CreatePaste creates a paste
-func (m *PasteFormModel) CreatePaste(paste, title, token string, expiresIn int) tea.Cmd {
-	// instead of sending cipher text directly create a json payload
-	// which will have paste title and cipher text both
-	plainCipherText, err := m.getCipherTextPayload(title, paste)
+// CreatePaste encrypts and signs the payload and sends it to the server
+func (m *PasteFormModel) CreatePaste(payload *paste.Payload, token string, expiresIn int) tea.Cmd {
+	user, err := m.store.Load()
 	if err != nil {
 		return func() tea.Msg {
 			return api.ErrMsg(err)
 		}
 	}
 
-	// use a new temp id to encrypt each new paste
-	tempID := uuid.New().String()
-
-	// encryt the payload
-	encrypted, err := crypt.EncryptPaste(tempID, plainCipherText)
+	compression, err := paste.ParseCompression(user.Compression)
 	if err != nil {
 		return func() tea.Msg {
 			return api.ErrMsg(err)
 		}
 	}
 
-	// encode the payload
-	encB64 := base64.StdEncoding.EncodeToString([]byte(encrypted))
-	user, err := config.Load()
+	sealed, err := paste.Seal(m.keys, payload, compression, user.PrivateKey)
 	if err != nil {
 		return func() tea.Msg {
 			return api.ErrMsg(err)
 		}
 	}
 
-	privKeyBytes, _ := base64.StdEncoding.DecodeString(user.PrivateKey)
-	sigBytes := ed25519.Sign(privKeyBytes, []byte(encrypted))
-	sigB64 := base64.StdEncoding.EncodeToString(sigBytes)
-
 	// Call API
-	return api.CreatePaste(api.PasteRequest{
-		Ciphertext: encB64,
-		Signature:  sigB64,
-		PublicKey:  user.PublicKey,
-		ExpiresIn:  expiresIn,
+	m.uploadID = sealed.TempID
+	return api.CreatePaste(m.req.start(), api.PasteRequest{
+		Ciphertext:     sealed.Ciphertext,
+		Signature:      sealed.Signature,
+		PublicKey:      user.PublicKey,
+		ExpiresIn:      expiresIn,
+		TitleHeader:    sealed.TitleHeader,
+		TitleSignature: sealed.TitleSignature,
 	},
 		token,
-		tempID)
+		sealed.TempID)
+}
+
+// draftContent is the title and body the way they would be saved, used to
+// tell whether anything changed since the last save
+func (m *PasteFormModel) draftContent() string {
+	title := m.title
+	if m.currentState == decidingTitle {
+		title = m.titleBar.Value()
+	}
+	return title + "\x00" + m.textarea.Value()
+}
+
+// autosave writes the draft when the text changed since the last save.
+// Attachments are not kept, they are still on disk where they came from.
+func (m *PasteFormModel) autosave() tea.Cmd {
+	if m.currentState != writingPaste || m.textarea.Value() == "" {
+		return nil
+	}
+	content := m.draftContent()
+	if content == m.draftSaved {
+		return nil
+	}
+	if m.draftID == "" {
+		m.draftID = drafts.NewID()
+	}
+	m.draftSaved = content
+	return saveDraftCmd(m.drafts, drafts.Draft{
+		ID:        m.draftID,
+		Title:     m.title,
+		Body:      m.textarea.Value(),
+		UpdatedAt: time.Now(),
+	})
+}
+
+// keepUndo remembers the text before alt+c or alt+n clears it
+func (m *PasteFormModel) keepUndo() {
+	if m.textarea.Value() == "" {
+		return
+	}
+	m.undo = &formSnapshot{title: m.title, body: m.textarea.Value(), draftID: m.draftID}
+}
+
+// updateDraftPicker handles keys while the drafts list is shown
+func (m *PasteFormModel) updateDraftPicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		d, ok := m.draftList.SelectedItem().(draftItem)
+		if !ok {
+			return m, nil
+		}
+		m.title = d.Draft.Title
+		m.textarea.SetValue(d.Body)
+		m.textarea.Focus()
+		m.draftID = d.ID
+		m.draftSaved = m.draftContent()
+		m.currentState = writingPaste
+		return m, nil
+
+	case "n", "esc":
+		m.currentState = decidingTitle
+		return m, nil
+
+	case "d":
+		d, ok := m.draftList.SelectedItem().(draftItem)
+		if !ok {
+			return m, nil
+		}
+		m.draftList.RemoveItem(m.draftList.Index())
+		if len(m.draftList.Items()) == 0 {
+			m.currentState = decidingTitle
+		}
+		return m, deleteDraftCmd(m.drafts, d.ID)
+	}
+
+	var cmd tea.Cmd
+	m.draftList, cmd = m.draftList.Update(msg)
+	return m, cmd
+}
+
+// scanTarget is the text that will be published, attachments that are
+// not text are not scanned
+func (m *PasteFormModel) scanTarget() string {
+	if m.attachment == nil {
+		return m.textarea.Value()
+	}
+	if m.attachment.IsText() {
+		return string(m.attachment.Body)
+	}
+	return ""
+}
+
+// updateScanReview lets the user redact the findings, publish anyway or
+// go back to editing
+func (m *PasteFormModel) updateScanReview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "r":
+		redacted := scan.Redact(m.scanTarget(), m.findings)
+		if m.attachment != nil {
+			m.attachment.Body = []byte(redacted)
+			m.attachment.Size = int64(len(redacted))
+		} else {
+			m.textarea.SetValue(redacted)
+		}
+		m.findings = nil
+		m.currentState = selectingExpiry
+	case "p":
+		m.findings = nil
+		m.currentState = selectingExpiry
+	case "c", "esc":
+		m.findings = nil
+		m.textarea.Focus()
+		m.currentState = writingPaste
+	}
+	return m, nil
+}
+
+// maxFindingsShown keeps the review screen within a normal terminal
+const maxFindingsShown = 8
+
+func (m *PasteFormModel) renderFindings() string {
+	out := styles.ErrStyle.Render("⚠ This paste looks like it contains secrets: " + scan.Summary(m.findings))
+	out += "\n\n"
+	for i, f := range m.findings {
+		if i == maxFindingsShown {
+			out += styles.SubtleStyle.Render(fmt.Sprintf("  … and %d more", len(m.findings)-maxFindingsShown)) + "\n"
+			break
+		}
+		out += "  • " + f.String() + "\n"
+	}
+	out += "\n" + styles.SubtleStyle.Render("Published pastes stay on the server for up to 7 days.")
+	out += "\n" + styles.HelpStyle.Render("r redact and continue | p publish as is | c cancel and keep editing")
+	return out
+}
+
+// updateFileInput handles keys while the attach prompt is open
+func (m *PasteFormModel) updateFileInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.fileInput.Blur()
+		m.textarea.Focus()
+		m.currentState = writingPaste
+		return m, nil
+
+	case "enter":
+		attachment, err := paste.FromFile(expandHome(m.fileInput.Value()), m.title)
+		if err != nil {
+			m.currentState = formErr
+			m.ErrMsg = err.Error()
+			return m, nil
+		}
+		m.attachment = attachment
+		m.fileInput.Blur()
+		m.currentState = writingPaste
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.fileInput, cmd = m.fileInput.Update(msg)
+	return m, cmd
 }
 
 // remapTempIdCmd remaps the TempID to actualID given by the server
 
-func remapTempIdCmd(tempID, actualID string) tea.Cmd {
+func remapTempIdCmd(keys crypt.KeyStore, tempID, actualID string) tea.Cmd {
 	return func() tea.Msg {
-		if err := crypt.MoveKey(tempID, actualID); err != nil {
+		if err := crypt.MoveKey(keys, tempID, actualID); err != nil {
 			return api.ErrMsg(err)
 		}
 		return nil
 	}
 }
 
-// returns a cipher text payload which have fields title and paste
-func (m *PasteFormModel) getCipherTextPayload(title, paste string) ([]byte, error) {
-	blob := cipherTextPayload{
-		Title: title,
-		Paste: paste,
-	}
-	return json.Marshal(blob)
-}
-
 func (m *PasteFormModel) renderHelp() string {
 	helpStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("241")).
@@ -362,10 +821,26 @@ func (m *PasteFormModel) renderHelp() string {
 		MarginTop(1)
 
 	return helpStyle.Render(
-		"Ctrl+S to submit | Esc to switch mode | Alt+V preview | Alt+C clear | Alt+N new paste",
+		"Ctrl+S to submit | Esc to switch mode | Alt+V preview | Alt+C clear | Alt+U undo | Alt+A attach file | Alt+T template | Alt+N new paste",
 	)
 }
 
+// Leave cancels an upload still in flight on logout and quit. Switching
+// tabs does not call it, uploads keep going meanwhile.
+func (m *PasteFormModel) Leave() {
+	if m.currentState != publishingPaste {
+		return
+	}
+	m.req.stop()
+	m.uploadID = ""
+	m.publishing = ""
+	m.currentState = writingPaste
+}
+
+func (m *PasteFormModel) SetToken(token string) {
+	m.token = token
+}
+
 func (m *PasteFormModel) Title() string {
 	return "Create Paste"
 }
@@ -1,13 +1,14 @@
 package views
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"os"
 
 	"Drop-Key-TUI/api"
 	"Drop-Key-TUI/config"
 	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/paste"
 	"Drop-Key-TUI/tui/styles"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -16,13 +17,13 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/x/term"
 )
 
 type pasteWithTitle struct {
 	api.Paste
 	Title_ string
 	Desc   string
+	Trust  crypt.TrustStatus
 }
 
 type pasteItem struct {
@@ -44,63 +45,106 @@ const (
 type PasteListModel struct {
 	currentState   pasteListState
 	list           list.Model
-	pastes         []api.Paste
 	spinner        spinner.Model
 	viewport       viewport.Model
 	selected       *pasteWithTitle
 	currentPasteID string
 	selectedIndex  int
-	publicKey      string
+	openErr        string
+	payload        *paste.Payload
+	notice         string
+	repairNotice   string
+	// content is the open paste as it was handed to glamour, kept to
+	// render it again when the window is resized
+	content string
+
+	store config.Store
+	keys  crypt.KeyStore
+
+	// the list is fetched a page at a time, first the pastes of the
+	// current key and then those of each retired one, which are all
+	// older. keyIndex is the key being paged through, pendingCursor the
+	// page being loaded and nextCursor the one after the last loaded page.
+	publicKeys    []string
+	keyIndex      int
+	loading       bool
+	pendingCursor string
+	nextCursor    string
+	totals        []int
+	total         int
+
+	// pages are fetched and their titles decrypted, one pool per page,
+	// under loadCtx until the user leaves the tab. titleGen tells the
+	// current fetch apart from ones that were cancelled.
+	titleGen   int
+	loadCtx    context.Context
+	cancelLoad context.CancelFunc
+	// loadRetry is shown while a page is being retried, the spinner
+	// ticks while loading so it gets rendered
+	loadRetry *retryStatus
+
+	// req is the paste being opened
+	req inflight
 }
 
+// listWidth is narrow on purpose, the list delegate truncates long titles
+const listWidth = 20
+
+// loadAhead is how close the cursor gets to the end of the loaded pastes
+// before the next page is fetched
+const loadAhead = 10
+
 type DecryptedPasteMsg struct {
 	ID        string
 	Title     string
 	PlainText string
+	Trust     crypt.TrustStatus
+	Badge     string
+	Payload   *paste.Payload
 	Err       error
 }
 
-func NewPasteListModel() *PasteListModel {
-	physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
-	const defaultWidth = 20
-	l := list.New(nil, list.NewDefaultDelegate(), defaultWidth, physicalHeight-10)
+func NewPasteListModel(store config.Store, keys crypt.KeyStore) *PasteListModel {
+	l := list.New(nil, list.NewDefaultDelegate(), listWidth, 0)
 	l.Title = styles.HeaderStyle.Render("📄 Your Pastes ")
 	l.SetShowHelp(false)
 	l.SetFilteringEnabled(false)
 
 	s := spinner.New()
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-	cfg, err := config.Load()
-	if err != nil {
-    fmt.Println(err)
-		cfg = &config.Config{}
-	}
-	publicKey := cfg.PublicKey
 
-	vp := viewport.New(physicalWidth-18, physicalHeight-10)
+	vp := viewport.New(0, 0)
 	vp.Style = styles.VpStyle
 
 	return &PasteListModel{
 		viewport:     vp,
 		spinner:      s,
-		publicKey:    publicKey,
 		currentState: showList,
 		list:         l,
-		pastes:       nil,
+		store:        store,
+		keys:         keys,
 	}
 }
 
 func (m *PasteListModel) Init() tea.Cmd {
-    cfg, err := config.Load()
-    if err != nil {
-        fmt.Println("Failed to load config:", err)
-        return nil
-    }
-
-    m.publicKey = cfg.PublicKey
-    return tea.Batch(api.GetPastes(m.publicKey), m.spinner.Tick)
+	cfg, err := m.store.Load()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return nil
+	}
+
+	m.publicKeys = cfg.PublicKeys()
+	return m.fetchFirstPage()
 }
 
+func (m *PasteListModel) SetSize(width, height int) {
+	m.list.SetSize(listWidth, max(height-10, 1))
+	m.viewport.Width = max(width-18, 1)
+	m.viewport.Height = max(height-10, 1)
+	if m.currentState == viewingPaste && m.content != "" {
+		m.UpdateViewportContent(m.content)
+	}
+}
 
 func (m *PasteListModel) UpdateViewportContent(paste string) {
 	const glamourGutter = 2
@@ -125,22 +169,179 @@ func (m *PasteListModel) UpdateViewportContent(paste string) {
 	m.viewport.SetContent(str)
 }
 
+// fetchFirstPage drops whatever is being loaded or decrypted and starts
+// the list over
+func (m *PasteListModel) fetchFirstPage() tea.Cmd {
+	m.Leave()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.loadRetry = &retryStatus{}
+	m.loadCtx, m.cancelLoad = api.WithRetryHook(ctx, m.loadRetry.set), cancel
+	m.titleGen++
+	m.loading = true
+	m.keyIndex = 0
+	m.pendingCursor = ""
+	m.totals = make([]int, len(m.publicKeys))
+	return tea.Batch(api.GetPastesPage(m.loadCtx, m.publicKeys[0], "", api.PastePageSize), m.spinner.Tick)
+}
+
+// loadMore fetches the next page once the cursor nears the end of the
+// loaded pastes, moving on to the next retired key after the last page
+// of a key
+func (m *PasteListModel) loadMore() tea.Cmd {
+	if m.loading || m.cancelLoad == nil || m.list.Index() < len(m.list.Items())-loadAhead {
+		return nil
+	}
+	if m.nextCursor == "" {
+		if m.keyIndex+1 >= len(m.publicKeys) {
+			return nil
+		}
+		m.keyIndex++
+	}
+	m.loading = true
+	m.pendingCursor = m.nextCursor
+	return tea.Batch(api.GetPastesPage(m.loadCtx, m.publicKeys[m.keyIndex], m.nextCursor, api.PastePageSize), m.spinner.Tick)
+}
+
+func (m *PasteListModel) addPage(msg api.PastePageFetchedMsg) tea.Cmd {
+	if !m.loading || msg.Cursor != m.pendingCursor || msg.PublicKey != m.publicKeys[m.keyIndex] {
+		return nil
+	}
+	m.loading = false
+	m.loadRetry.clear()
+	m.nextCursor = msg.NextCursor
+	m.totals[m.keyIndex] = msg.Total
+	m.total = 0
+	for _, n := range m.totals {
+		m.total += n
+	}
+
+	var items []list.Item
+	if msg.Cursor != "" || m.keyIndex > 0 {
+		items = m.list.Items()
+	}
+	first := len(items)
+	for _, p := range msg.Pastes {
+		items = append(items, pasteItem{
+			pasteWithTitle: pasteWithTitle{
+				Paste:  p,
+				Title_: pendingTitle,
+				Desc:   crypt.Fingerprint(p.PublicKey),
+			},
+		})
+	}
+	m.list.SetItems(items)
+	// a short page does not fill the list, so no key press would ask
+	// for the next one
+	return tea.Batch(m.startTitles(first, msg.Pastes), m.loadMore())
+}
+
+// startTitles decrypts the titles of a page that was added at index first
+func (m *PasteListModel) startTitles(first int, pastes []api.Paste) tea.Cmd {
+	if len(pastes) == 0 || m.cancelLoad == nil {
+		return nil
+	}
+	results := decryptTitles(m.loadCtx, m.keys, loadSigners(m.store), first, pastes)
+	return nextTitles(m.titleGen, results)
+}
+
+// Leave stops loading pages, decrypting titles and opening a paste when
+// the user switches to another tab, the list is fetched again when they
+// come back
+func (m *PasteListModel) Leave() {
+	if m.cancelLoad != nil {
+		m.cancelLoad()
+		m.cancelLoad = nil
+	}
+	m.loading = false
+	m.req.stop()
+	if m.currentState == decryptingPaste {
+		m.currentState = showList
+	}
+}
+
+// fillTitles sets the decrypted titles and drops the ciphertext of those
+// rows, so a long list only keeps metadata. Opening a row fetches the
+// paste again.
+func (m *PasteListModel) fillTitles(msg titlesDecryptedMsg) tea.Cmd {
+	if msg.gen != m.titleGen {
+		return nil
+	}
+
+	items := m.list.Items()
+	for _, t := range msg.titles {
+		if t.index >= len(items) {
+			continue
+		}
+		it, ok := items[t.index].(pasteItem)
+		if !ok {
+			continue
+		}
+		it.Title_ = t.title
+		it.Trust = t.trust
+		it.Desc = t.trust.String() + " · " + crypt.Fingerprint(it.PublicKey)
+		it.Ciphertext = ""
+		m.list.SetItem(t.index, it)
+	}
+
+	if msg.done {
+		return nil
+	}
+	return nextTitles(msg.gen, msg.results)
+}
+
 func (m *PasteListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(titlesDecryptedMsg); ok {
+		return m, m.fillTitles(msg)
+	}
+
+	if msg, ok := msg.(KeysRepairedMsg); ok {
+		if msg.Err != nil {
+			m.repairNotice = "Key repair failed: " + msg.Err.Error()
+			return m, nil
+		}
+		// the list is fetched again whenever the tab is opened
+		m.repairNotice = fmt.Sprintf("Recovered the keys of %d pastes from an interrupted upload", msg.Recovered)
+		return m, nil
+	}
+
 	if m.currentState == decryptingPaste {
 		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			if msg.String() == "esc" {
+				m.req.stop()
+				m.currentState = showList
+			}
+			return m, nil
+
 		case DecryptedPasteMsg:
+			if msg.ID != m.currentPasteID {
+				// a paste whose opening was cancelled
+				return m, nil
+			}
+			m.req.stop()
 			if msg.Err != nil {
+				m.openErr = msg.Err.Error()
 				m.currentState = showList
 				return m, nil
 			}
+			m.openErr = ""
 
 			m.selected = &pasteWithTitle{
 				Paste:  api.Paste{ID: msg.ID},
 				Title_: msg.Title,
-				Desc:   msg.PlainText,
+				Desc:   msg.Badge,
+				Trust:  msg.Trust,
 			}
 
-			m.UpdateViewportContent(msg.PlainText)
+			m.payload = msg.Payload
+			m.notice = ""
+			m.content = ""
+			if msg.Payload != nil && !msg.Payload.IsText() {
+				m.viewport.SetContent(attachmentCard(msg.Payload))
+			} else {
+				m.content = msg.PlainText
+				m.UpdateViewportContent(msg.PlainText)
+			}
 			m.currentState = viewingPaste
 			m.currentPasteID = msg.ID
 			return m, nil
@@ -173,7 +374,13 @@ func (m *PasteListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.viewport.ScrollUp(m.viewport.Height)
 			case "pgdown":
 				m.viewport.ScrollDown(m.viewport.Height)
+			case "ctrl+o":
+				if m.payload != nil && m.payload.IsAttachment() {
+					return m, saveAttachmentCmd(m.payload)
+				}
 			}
+		case attachmentSavedMsg:
+			m.notice = msg.notice()
 		}
 		return m, nil
 
@@ -184,56 +391,66 @@ func (m *PasteListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "enter":
 				if i, ok := m.list.SelectedItem().(pasteItem); ok {
 					m.currentState = decryptingPaste
-					return m, decryptPasteCmd(i)
+					m.currentPasteID = i.ID
+					return m, tea.Batch(decryptPasteCmd(m.req.start(), m.store, m.keys, i), m.spinner.Tick)
 				}
-      case "ctrl+r":
-          cfg, err := config.Load()
-          if err != nil {
-              fmt.Println("Failed to reload config:", err)
-              return m, nil
-          }
-
-          m.publicKey = cfg.PublicKey
-          return m, api.GetPastes(m.publicKey)
-
-        }
-		case api.PasteListFetchedMsg:
-			m.pastes = msg.List
-
-			items := make([]list.Item, len(msg.List))
-			for i, p := range msg.List {
-				items[i] = pasteItem{
-					pasteWithTitle: pasteWithTitle{
-						Paste:  p,
-						Title_: msg.Titles[i], // use title from the parallel slice
-						Desc:   "Press Enter to view",
-					},
+			case "ctrl+r":
+				cfg, err := m.store.Load()
+				if err != nil {
+					fmt.Println("Failed to reload config:", err)
+					return m, nil
 				}
-			}
 
-			m.list.SetItems(items)
-			return m, nil
+				m.publicKeys = cfg.PublicKeys()
+				return m, m.fetchFirstPage()
 
+			}
+		case api.PastePageFetchedMsg:
+			return m, m.addPage(msg)
+
+		case spinner.TickMsg:
+			if m.loading {
+				var cmd tea.Cmd
+				m.spinner, cmd = m.spinner.Update(msg)
+				return m, cmd
+			}
+
+		case api.ErrMsg:
+			if m.loading {
+				m.loading = false
+				m.openErr = "Failed to load pastes: " + msg.Error()
+				return m, nil
+			}
 		}
 	}
 
 	var cmd tea.Cmd
 	m.list, cmd = m.list.Update(msg)
+	if m.currentState == showList {
+		return m, tea.Batch(cmd, m.loadMore())
+	}
 	return m, cmd
 }
 
 func (m *PasteListModel) viewSelectedPaste() string {
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("210")).Render(m.selected.Title_)
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render("Press Esc to go back")
-	return fmt.Sprintf("📋 %s\n%s\n%s", title, m.viewport.View(), help)
+	helpText := "Press Esc to go back"
+	if m.payload != nil && m.payload.IsAttachment() {
+		helpText += " | Ctrl+O to save attachment"
+	}
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render(helpText)
+	if m.notice != "" {
+		help = styles.SubtleStyle.Render(m.notice) + "\n" + help
+	}
+	return fmt.Sprintf("📋 %s %s\n%s\n%s", title, m.selected.Desc, m.viewport.View(), help)
 }
 
 func (m *PasteListModel) View() string {
 	switch m.currentState {
 	case decryptingPaste:
 		text := lipgloss.NewStyle().Foreground(lipgloss.Color("241")).
-			Render("🔐 Decrypting paste...")
-		return fmt.Sprintf("\n%s %s\n", m.spinner.View(), text)
+			Render("🔐 Decrypting paste..." + m.req.retrying())
+		return fmt.Sprintf("\n%s %s\n%s", m.spinner.View(), text, styles.HelpStyle.Render("esc to cancel"))
 
 	case viewingPaste:
 		if m.selected != nil {
@@ -242,11 +459,34 @@ func (m *PasteListModel) View() string {
 		return "⚠️ No paste selected"
 
 	default:
-		help := styles.HelpStyle.Render("j k , h l, arrow keys to navigate | Ctrl+R to refresh")
+		help := styles.HelpStyle.Render("j k , h l, arrow keys to navigate | Ctrl+R to refresh | Ctrl+X to logout")
+		if m.openErr != "" {
+			help = styles.ErrorStyle.Render("✘ "+m.openErr) + "\n" + help
+		}
+		if m.repairNotice != "" {
+			help = styles.SubtleStyle.Render(m.repairNotice) + "\n" + help
+		}
+		if count := m.countLine(); count != "" {
+			help = styles.SubtleStyle.Render(count) + "\n" + help
+		}
 		return "\n" + m.list.View() + "\n" + help
 	}
 }
 
+// countLine tells how much of the list is loaded
+func (m *PasteListModel) countLine() string {
+	loaded := len(m.list.Items())
+	switch {
+	case m.loading && loaded > 0:
+		return fmt.Sprintf("%d of %d pastes, loading more...", loaded, m.total) + m.loadRetry.String()
+	case m.loading && m.loadRetry.String() != "":
+		return "Loading pastes..." + m.loadRetry.String()
+	case m.total > 0:
+		return fmt.Sprintf("%d of %d pastes", loaded, m.total)
+	}
+	return ""
+}
+
 func (m *PasteListModel) Title() string {
 	if m.selected != nil {
 		return "Paste Detail"
@@ -254,22 +494,45 @@ func (m *PasteListModel) Title() string {
 	return "Paste List"
 }
 
-func decryptPasteCmd(p pasteItem) tea.Cmd {
+func decryptPasteCmd(ctx context.Context, store config.Store, keys crypt.KeyStore, p pasteItem) tea.Cmd {
 	return func() tea.Msg {
-		plain, err := crypt.DecryptPaste(p.ID, p.Ciphertext)
-		if err != nil {
-			fmt.Printf("error while decrypting : %v", err)
-			return DecryptedPasteMsg{Err: err}
+		if p.Streamed {
+			return DecryptedPasteMsg{
+				ID:  p.ID,
+				Err: fmt.Errorf("this paste is too large to view here, download it with `dropkey get -o ~/Downloads %s`", p.ID),
+			}
 		}
 
-		var data struct {
-			Title string `json:"title"`
-			Paste string `json:"paste"`
+		// rows drop their ciphertext once the title is shown
+		if p.Ciphertext == "" {
+			switch msg := api.GetPaste(ctx, p.ID)().(type) {
+			case api.PasteFetchedMsg:
+				p.Paste = msg.Paste
+			case api.ErrMsg:
+				return DecryptedPasteMsg{ID: p.ID, Err: msg}
+			default:
+				return DecryptedPasteMsg{ID: p.ID, Err: fmt.Errorf("unexpected answer %T fetching the paste", msg)}
+			}
+		}
+
+		signers := loadSigners(store)
+		opened, err := crypt.VerifyAndOpen(keys, p.ID, p.Ciphertext, p.Signature, p.PublicKey, signers.Known)
+		if err != nil {
+			return DecryptedPasteMsg{ID: p.ID, Err: err}
 		}
-		if err := json.Unmarshal([]byte(plain), &data); err != nil {
+		if opened.Status == crypt.BadSignature {
+			return DecryptedPasteMsg{
+				ID:    p.ID,
+				Trust: opened.Status,
+				Err:   errors.New("signature does not match the paste contents"),
+			}
+		}
+
+		payload, err := paste.Unmarshal(opened.Plaintext)
+		if err != nil {
 			return DecryptedPasteMsg{
 				ID:        p.ID,
-				Title:     "Invalid JSON",
+				Title:     "Invalid payload",
 				PlainText: "",
 				Err:       err,
 			}
@@ -277,8 +540,11 @@ func decryptPasteCmd(p pasteItem) tea.Cmd {
 
 		return DecryptedPasteMsg{
 			ID:        p.ID,
-			Title:     data.Title, // use decrypted title
-			PlainText: data.Paste, // only paste body
+			Title:     payload.Title, // use decrypted title
+			PlainText: renderableText(payload),
+			Payload:   payload,
+			Trust:     opened.Status,
+			Badge:     signers.Badge(opened.Status, opened.Signer),
 			Err:       nil,
 		}
 	}
@@ -0,0 +1,50 @@
+package views
+
+import (
+	"testing"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+)
+
+func TestPasteListPagesRetiredKeys(t *testing.T) {
+	store := config.NewMemoryStore()
+	store.UseDir(t.TempDir())
+	m := NewPasteListModel(store, crypt.NewMemoryKeyStore())
+	m.publicKeys = []string{"current", "retired"}
+	m.fetchFirstPage()
+	defer m.Leave()
+
+	page := func(publicKey, cursor, next string, total int, ids ...string) api.PastePageFetchedMsg {
+		msg := api.PastePageFetchedMsg{PublicKey: publicKey, Cursor: cursor}
+		msg.NextCursor, msg.Total = next, total
+		for _, id := range ids {
+			msg.Pastes = append(msg.Pastes, api.Paste{ID: id, PublicKey: publicKey})
+		}
+		return msg
+	}
+
+	m.addPage(page("current", "", "", 1, "new"))
+	// the current key has no more pages, the retired key is next
+	if !m.loading || m.keyIndex != 1 || m.pendingCursor != "" {
+		t.Fatalf("after the current key: loading %v, key %d, cursor %q", m.loading, m.keyIndex, m.pendingCursor)
+	}
+
+	// a late page of the current key is not taken for the retired one
+	m.addPage(page("current", "", "", 1, "again"))
+	if n := len(m.list.Items()); n != 1 {
+		t.Fatalf("%d rows after a stale page", n)
+	}
+
+	m.addPage(page("retired", "", "", 2, "old-1", "old-2"))
+	items := m.list.Items()
+	if len(items) != 3 || m.total != 3 || m.loading {
+		t.Fatalf("%d rows of %d, loading %v", len(items), m.total, m.loading)
+	}
+	for i, want := range []string{"new", "old-1", "old-2"} {
+		if id := items[i].(pasteItem).ID; id != want {
+			t.Fatalf("row %d is %q, want %q", i, id, want)
+		}
+	}
+}
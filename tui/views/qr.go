@@ -0,0 +1,81 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"rsc.io/qr"
+)
+
+// qrQuietZone is the blank border around the code in modules. The spec
+// asks for 4 but phone scanners cope with 2, which saves a lot of space.
+const qrQuietZone = 2
+
+var errQRTooSmall = errors.New("terminal too small for QR code")
+
+// qrStyle forces light modules on a dark background whatever the terminal
+// theme is, scanners need the contrast more than the colours.
+var qrStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#FFFFFF")).
+	Background(lipgloss.Color("#000000"))
+
+// renderQR draws text as a QR code with Unicode half blocks, two modules
+// per character row. It returns errQRTooSmall, wrapped with the size it
+// needs, when the code does not fit in width x height cells.
+func renderQR(text string, width, height int) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		code, err = qr.Encode(text, qr.L)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	modules := code.Size + 2*qrQuietZone
+	lines := (modules + 1) / 2
+	if modules > width || lines > height {
+		return "", fmt.Errorf("%w: needs %dx%d, have %dx%d", errQRTooSmall, modules, lines, width, height)
+	}
+
+	// light reports whether the module at (x, y) is drawn, counting the
+	// quiet zone as light
+	light := func(x, y int) bool {
+		return !code.Black(x-qrQuietZone, y-qrQuietZone)
+	}
+
+	rows := make([]string, 0, lines)
+	for y := 0; y < modules; y += 2 {
+		var row strings.Builder
+		for x := 0; x < modules; x++ {
+			top := light(x, y)
+			bottom := y+1 < modules && light(x, y+1)
+			switch {
+			case top && bottom:
+				row.WriteRune('█')
+			case top:
+				row.WriteRune('▀')
+			case bottom:
+				row.WriteRune('▄')
+			default:
+				row.WriteRune(' ')
+			}
+		}
+		rows = append(rows, qrStyle.Render(row.String()))
+	}
+	return strings.Join(rows, "\n"), nil
+}
+
+// qrOrHint renders the code, or a short hint when it does not fit, so the
+// caller never has to deal with a half-drawn code.
+func qrOrHint(text string, width, height int) string {
+	code, err := renderQR(text, width, height)
+	if err != nil {
+		if errors.Is(err, errQRTooSmall) {
+			return "Enlarge the terminal to show a QR code (" + strings.TrimPrefix(err.Error(), errQRTooSmall.Error()+": ") + ")"
+		}
+		return "Could not render QR code: " + err.Error()
+	}
+	return code
+}
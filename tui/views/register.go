@@ -1,18 +1,22 @@
 package views
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"Drop-Key-TUI/api"
 	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
 	"Drop-Key-TUI/tui/styles"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -26,14 +30,24 @@ const (
 	generatingKey   State = "generating key"
 	fetchingKeys    State = "fetching keys"
 	enterKeyFile    State = "enter key file"
+	enterPassphrase State = "enter passphrase"
 	registering     State = "registering"
 	redirectToLogin State = "redirecting to login"
+	offerPhrase     State = "offer recovery phrase"
+	showingPhrase   State = "showing recovery phrase"
+	confirmingWords State = "confirming recovery phrase"
+	confirmReplace  State = "confirming identity replacement"
 )
 
+// phraseWordsToConfirm is how many words of the recovery phrase the user has to
+// type back before registration continues.
+const phraseWordsToConfirm = 3
+
 type RegisterModel struct {
 	CurrentState  State
 	List          list.Model
 	ti            textinput.Model
+	passphrase    textinput.Model
 	statusMessage string
 	err           error
 	width         int
@@ -41,6 +55,21 @@ type RegisterModel struct {
 	user          api.User
 	ID            string
 	token         string
+
+	// recovery phrase of a freshly generated key, cleared once confirmed
+	phrase       []string
+	phraseChecks []int
+	phraseStep   int
+	phraseInput  textinput.Model
+	phraseNotice string
+
+	// imported identity waiting for the user to agree to replace the
+	// configured one
+	pendingIdentity *crypt.Identity
+	replacedKey     string
+
+	store config.Store
+	req   inflight
 }
 
 type RegistrationSuccessMsg struct {
@@ -53,6 +82,7 @@ type RegistrationErrorMsg struct {
 
 type KeysGenerated struct {
 	PublicKey string
+	Phrase    []string
 }
 
 type FetchedKeys struct {
@@ -60,6 +90,15 @@ type FetchedKeys struct {
 	PrivateKey string `json:"private_key"`
 }
 
+type passphraseRequiredMsg struct{}
+
+// replaceIdentityMsg asks before an import overwrites an identity with a
+// different key
+type replaceIdentityMsg struct {
+	identity    *crypt.Identity
+	existingKey string
+}
+
 type item struct {
 	title, desc string
 }
@@ -73,16 +112,17 @@ func (m *RegisterModel) SetSize(width, height int) {
 	m.height = height
 	m.List.SetSize(width-8, height-5)
 	m.ti.Width = width - 10
+	m.phraseInput.Width = width - 10
 }
 
 func (i item) Title() string       { return i.title }
 func (i item) Description() string { return i.desc }
 func (i item) FilterValue() string { return i.title }
 
-func NewRegisterModel() *RegisterModel {
+func NewRegisterModel(store config.Store) *RegisterModel {
 	items := []list.Item{
 		item{title: "Generate a new key pair (recommended)", desc: "Creates a new secure key pair for you."},
-		item{title: "Use an existing private key file", desc: "Import an existing private key file."},
+		item{title: "Use an existing private key file", desc: "Import a DropKey JSON, OpenSSH (~/.ssh/id_ed25519), PKCS#8 PEM or raw seed key."},
 	}
 
 	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
@@ -92,13 +132,25 @@ func NewRegisterModel() *RegisterModel {
 	l.Styles.Title = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("218"))
 
 	ti := textinput.New()
-	ti.Placeholder = "Enter file location..."
+	ti.Placeholder = "Enter file location, e.g. ~/.ssh/id_ed25519, or your recovery phrase..."
 	ti.Focus()
 
+	passphrase := textinput.New()
+	passphrase.Placeholder = "Key passphrase"
+	passphrase.EchoMode = textinput.EchoPassword
+	passphrase.EchoCharacter = '•'
+
+	phraseInput := textinput.New()
+	phraseInput.Placeholder = "word"
+	phraseInput.CharLimit = 16
+
 	return &RegisterModel{
 		CurrentState: selectingMethod,
 		List:         l,
 		ti:           ti,
+		passphrase:   passphrase,
+		phraseInput:  phraseInput,
+		store:        store,
 	}
 }
 
@@ -111,6 +163,7 @@ func (m *RegisterModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		// Global quit key handling
 		if msg.String() == "ctrl+c" || msg.String() == "esc" {
+			m.req.stop()
 			return m, tea.Quit
 		}
 
@@ -138,7 +191,62 @@ func (m *RegisterModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case enterKeyFile:
 			if msg.String() == "enter" {
 				m.CurrentState = fetchingKeys
-				return m, m.LoadKeys(m.ti.Value())
+				if crypt.LooksLikeMnemonic(m.ti.Value()) {
+					phrase := m.ti.Value()
+					m.ti.SetValue("")
+					return m, restoreFromPhraseCmd(m.store, phrase)
+				}
+				return m, m.LoadKeys(m.ti.Value(), "")
+			}
+
+		case offerPhrase:
+			switch msg.String() {
+			case "y":
+				m.CurrentState = showingPhrase
+			case "n":
+				m.phrase = nil
+				m.CurrentState = registering
+				return m, registerUser(m.req.start(), m.store)
+			}
+			return m, nil
+
+		case showingPhrase:
+			if msg.String() == "enter" {
+				m.phraseChecks = pickPhraseChecks()
+				m.phraseStep = 0
+				m.phraseNotice = ""
+				m.phraseInput.SetValue("")
+				m.phraseInput.Focus()
+				m.CurrentState = confirmingWords
+				return m, textinput.Blink
+			}
+			return m, nil
+
+		case confirmingWords:
+			if msg.String() == "enter" {
+				return m.checkPhraseWord()
+			}
+
+		case confirmReplace:
+			switch msg.String() {
+			case "y":
+				identity := m.pendingIdentity
+				m.pendingIdentity = nil
+				m.CurrentState = fetchingKeys
+				return m, saveIdentityCmd(m.store, identity, true)
+			case "n":
+				m.pendingIdentity = nil
+				m.CurrentState = selectingMethod
+			}
+			return m, nil
+
+		case enterPassphrase:
+			if msg.String() == "enter" {
+				m.CurrentState = fetchingKeys
+				passphrase := m.passphrase.Value()
+				m.passphrase.SetValue("")
+				m.passphrase.Blur()
+				return m, m.LoadKeys(m.ti.Value(), passphrase)
 			}
 
 		case err:
@@ -171,17 +279,30 @@ func (m *RegisterModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 	}
 
+	if m.CurrentState == enterPassphrase {
+		var cmd tea.Cmd
+		m.passphrase, cmd = m.passphrase.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+
+	if m.CurrentState == confirmingWords {
+		var cmd tea.Cmd
+		m.phraseInput, cmd = m.phraseInput.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+
 	// Handle custom messages
 	switch msg := msg.(type) {
 	case KeysGenerated:
-		m.CurrentState = registering
-		m.statusMessage = "generated PublicKey = " + msg.PublicKey
-		return m, registerUser()
+		m.statusMessage = "generated key with fingerprint " + crypt.Fingerprint(msg.PublicKey)
+		m.phrase = msg.Phrase
+		m.CurrentState = offerPhrase
+		return m, nil
 
 	case FetchedKeys:
 		m.CurrentState = registering
-		m.statusMessage = "Fetched Public Key successfully, Registering user"
-		return m, registerWithFetchedKey(msg.PublicKey)
+		m.statusMessage = "loaded key with fingerprint " + crypt.Fingerprint(msg.PublicKey)
+		return m, registerWithFetchedKey(m.req.start(), msg.PublicKey)
 
 	case api.RegisterUserResponse:
 		m.CurrentState = done
@@ -195,6 +316,17 @@ func (m *RegisterModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.statusMessage = fmt.Sprintf("Registration failed: %v", m.err)
 		return m, nil
 
+	case replaceIdentityMsg:
+		m.pendingIdentity = msg.identity
+		m.replacedKey = msg.existingKey
+		m.CurrentState = confirmReplace
+		return m, nil
+
+	case passphraseRequiredMsg:
+		m.CurrentState = enterPassphrase
+		m.passphrase.Focus()
+		return m, textinput.Blink
+
 	case RegistrationErrorMsg:
 		m.CurrentState = err
 		m.err = msg.err
@@ -218,13 +350,38 @@ func (m *RegisterModel) View() string {
 	case generatingKey:
 		b.WriteString("Generating key pair...\n")
 	case enterKeyFile:
-		b.WriteString("Enter path to private key file: \n")
+		b.WriteString("Enter path to private key file, or type your recovery phrase: \n")
 		b.WriteString(m.ti.View() + "\n")
 		b.WriteString("\nPress Enter to submit, Ctrl+C to quit")
+	case enterPassphrase:
+		b.WriteString("This key is protected by a passphrase: \n")
+		b.WriteString(m.passphrase.View() + "\n")
+		b.WriteString("\nPress Enter to unlock, Ctrl+C to quit")
 	case fetchingKeys:
-		b.WriteString("Fetched Keys, Registering user...")
+		b.WriteString("Loading keys...")
+	case confirmReplace:
+		b.WriteString(fmt.Sprintf("An identity with fingerprint %s is already configured.\n", crypt.Fingerprint(m.replacedKey)))
+		b.WriteString(fmt.Sprintf("Replacing it with %s loses its private key and rotation history.\n", crypt.Fingerprint(m.pendingIdentity.PublicKey)))
+		b.WriteString("\nPress y to replace it, n to keep it")
+	case offerPhrase:
+		b.WriteString(m.statusMessage + "\n\n")
+		b.WriteString("Show a recovery phrase for this key now? It is the only way to restore\n")
+		b.WriteString("your identity if this machine is lost.\n")
+		b.WriteString("\nPress y to show it, n to skip")
+	case showingPhrase:
+		b.WriteString("Write these words down in order and keep them somewhere safe:\n\n")
+		b.WriteString(renderPhrase(m.phrase))
+		if m.phraseNotice != "" {
+			b.WriteString("\n" + styles.ErrorStyle.Render(m.phraseNotice) + "\n")
+		}
+		b.WriteString("\nPress Enter once you have written them down")
+	case confirmingWords:
+		b.WriteString(fmt.Sprintf("Confirm your recovery phrase (%d/%d)\n\n", m.phraseStep+1, len(m.phraseChecks)))
+		b.WriteString(fmt.Sprintf("Word #%d:\n", m.phraseChecks[m.phraseStep]+1))
+		b.WriteString(m.phraseInput.View() + "\n")
+		b.WriteString("\nPress Enter to check")
 	case registering:
-		b.WriteString(fmt.Sprintf("Registering... usr with PublicKey %v \n", m.statusMessage))
+		b.WriteString(fmt.Sprintf("Registering %v...\n", m.statusMessage))
 	case err:
 		b.WriteString(m.statusMessage + "\n\nPress Enter to retry or Ctrl+C to quit")
 	case done:
@@ -256,12 +413,19 @@ func (m *RegisterModel) generateKeyCmd() tea.Cmd {
 		}
 	}
 
+	phrase, err := crypt.SeedToMnemonic(priv.Seed())
+	if err != nil {
+		return func() tea.Msg {
+			return RegistrationErrorMsg{err: err}
+		}
+	}
+
 	cfg := &config.Config{
 		PublicKey:  base64.StdEncoding.EncodeToString(pub),
 		PrivateKey: base64.StdEncoding.EncodeToString(priv),
 	}
 
-	err = config.Save(cfg)
+	err = m.store.Save(cfg)
 	if err != nil {
 		return func() tea.Msg {
 			return RegistrationErrorMsg{err: err}
@@ -271,24 +435,120 @@ func (m *RegisterModel) generateKeyCmd() tea.Cmd {
 	return func() tea.Msg {
 		return KeysGenerated{
 			PublicKey: cfg.PublicKey,
+			Phrase:    phrase,
+		}
+	}
+}
+
+// checkPhraseWord compares the typed word with the phrase. A wrong word
+// sends the user back to the phrase, the right last word registers.
+func (m *RegisterModel) checkPhraseWord() (tea.Model, tea.Cmd) {
+	want := m.phrase[m.phraseChecks[m.phraseStep]]
+	got := strings.ToLower(strings.TrimSpace(m.phraseInput.Value()))
+	m.phraseInput.SetValue("")
+
+	if got != want {
+		m.phraseNotice = fmt.Sprintf("Word #%d did not match, check what you wrote down.", m.phraseChecks[m.phraseStep]+1)
+		m.phraseInput.Blur()
+		m.CurrentState = showingPhrase
+		return m, nil
+	}
+
+	m.phraseStep++
+	if m.phraseStep < len(m.phraseChecks) {
+		return m, nil
+	}
+
+	m.phrase = nil
+	m.phraseChecks = nil
+	m.phraseInput.Blur()
+	m.CurrentState = registering
+	return m, registerUser(m.req.start(), m.store)
+}
+
+// pickPhraseChecks chooses which words to ask for, in phrase order.
+func pickPhraseChecks() []int {
+	checks := rand.Perm(crypt.MnemonicWords)[:phraseWordsToConfirm]
+	sort.Ints(checks)
+	return checks
+}
+
+func renderPhrase(words []string) string {
+	var b strings.Builder
+	for i, w := range words {
+		b.WriteString(fmt.Sprintf("%2d. %-10s", i+1, w))
+		if (i+1)%6 == 0 {
+			b.WriteString("\n")
+		}
+	}
+	return styles.MetaStyle.Render(b.String())
+}
+
+// restoreFromPhraseCmd rebuilds the identity from a recovery phrase and
+// saves it, then continues like an imported key file.
+func restoreFromPhraseCmd(store config.Store, phrase string) tea.Cmd {
+	identity, err := crypt.IdentityFromMnemonic(phrase)
+	if err != nil {
+		return func() tea.Msg {
+			return RegistrationErrorMsg{err: err}
+		}
+	}
+	return saveIdentityCmd(store, identity, false)
+}
+
+// saveIdentityCmd makes an imported identity the configured one. Like
+// `dropkey import`, an identity with another key is only replaced once
+// the user agreed to, its private key, rotation history and session are
+// dropped. Importing the key that is already configured keeps the config
+// as is.
+func saveIdentityCmd(store config.Store, identity *crypt.Identity, replace bool) tea.Cmd {
+	return func() tea.Msg {
+		existing, err := store.Load()
+		switch {
+		case err == nil && existing.PublicKey == identity.PublicKey:
+			// keep the retired keys and settings of the configured identity
+
+		case err == nil && existing.PublicKey != "" && !replace:
+			return replaceIdentityMsg{identity: identity, existingKey: existing.PublicKey}
+
+		default:
+			if err == nil && existing.PublicKey != "" {
+				// the user ID and session belong to the key being replaced
+				if err := store.ClearUserID(); err != nil {
+					return RegistrationErrorMsg{err: err}
+				}
+			}
+			if err := store.Save(&config.Config{
+				PublicKey:  identity.PublicKey,
+				PrivateKey: identity.PrivateKey,
+			}); err != nil {
+				return RegistrationErrorMsg{err: err}
+			}
+		}
+		return FetchedKeys{
+			PublicKey:  identity.PublicKey,
+			PrivateKey: identity.PrivateKey,
 		}
 	}
 }
 
-func registerUser() tea.Cmd {
-	cfg, err := config.Load()
+func registerUser(ctx context.Context, store config.Store) tea.Cmd {
+	cfg, err := store.Load()
 	if err != nil {
 		return func() tea.Msg {
 			return RegistrationErrorMsg{err: err}
 		}
 	}
 
-	registrationCmd := api.RegisterUser(cfg.PublicKey)
+	registrationCmd := api.RegisterUser(ctx, cfg.PublicKey)
 	return registrationCmd
 }
 
-func (m *RegisterModel) LoadKeys(path string) tea.Cmd {
-	rawConfigData, err := os.ReadFile(path)
+// LoadKeys imports an existing identity from a DropKey JSON file, an
+// OpenSSH or PKCS#8 private key, or a raw seed, and saves it as the
+// current config once the key pair checks out, see saveIdentityCmd.
+func (m *RegisterModel) LoadKeys(path, passphrase string) tea.Cmd {
+	rawKeyData, err := os.ReadFile(expandHome(path))
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return func() tea.Msg {
@@ -300,28 +560,42 @@ func (m *RegisterModel) LoadKeys(path string) tea.Cmd {
 		}
 	}
 
-	if len(rawConfigData) == 0 {
-		slog.Error("keys json file is empty")
+	identity, err := crypt.ParseIdentity(rawKeyData, []byte(passphrase))
+	if errors.Is(err, crypt.ErrPassphraseRequired) {
 		return func() tea.Msg {
-			return RegistrationErrorMsg{err: fmt.Errorf("empty json file")}
+			return passphraseRequiredMsg{}
 		}
 	}
-
-	var fetchedKeys FetchedKeys
-	if err := json.Unmarshal(rawConfigData, &fetchedKeys); err != nil {
-		slog.Error("error while decoding keys JSON%w", "error", err)
+	if err != nil {
+		slog.Error("error while parsing key file", "error", err)
 		return func() tea.Msg {
 			return RegistrationErrorMsg{err: err}
 		}
 	}
 
-	return func() tea.Msg {
-		return fetchedKeys
+	return saveIdentityCmd(m.store, identity, false)
+}
+
+// expandHome resolves a leading ~/ the way a shell would.
+func expandHome(path string) string {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
 	}
+	return filepath.Join(home, path[2:])
 }
 
-func registerWithFetchedKey(pubKey string) tea.Cmd {
-	return api.RegisterUser(pubKey)
+func registerWithFetchedKey(ctx context.Context, pubKey string) tea.Cmd {
+	return api.RegisterUser(ctx, pubKey)
 }
 
 func (m *RegisterModel) SetToken(token string) {}
+
+// Leave cancels a registration still in progress
+func (m *RegisterModel) Leave() {
+	m.req.stop()
+}
@@ -0,0 +1,91 @@
+package views
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// KeysRepairedMsg reports the paste keys recovered by RepairKeysCmd
+type KeysRepairedMsg struct {
+	Recovered int
+	Err       error
+}
+
+// RepairKeysCmd runs at login and gives back the keys of pastes whose
+// upload was cut off before the key was moved to the paste ID, see
+// crypt.RecoverOrphans. Nothing is reported when there was nothing to do.
+//
+// The list is walked a page at a time and ciphertexts are dropped with
+// their page. A first pass only rules out the keys named after a listed
+// paste, the second one, which most logins never get to, tries the
+// pastes without a key against the keys that are left.
+func RepairKeysCmd(ctx context.Context, store config.Store, keys crypt.KeyStore) tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := store.Load()
+		if err != nil {
+			return nil
+		}
+		ids, err := keys.ListKeys()
+		if err != nil || len(ids) == 0 {
+			return nil
+		}
+
+		// pastes signed before a rotation are listed under the retired key
+		eachPage := func(fn func([]api.Paste) error) error {
+			for _, publicKey := range cfg.PublicKeys() {
+				if err := api.EachPastePage(ctx, publicKey, fn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		orphans := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			orphans[id] = true
+		}
+		err = eachPage(func(pastes []api.Paste) error {
+			for _, p := range pastes {
+				delete(orphans, p.ID)
+			}
+			return nil
+		})
+		if err != nil || len(orphans) == 0 {
+			return nil
+		}
+
+		// only a key that could not be moved is reported, the list failing
+		// to load is not
+		recovered := 0
+		var moveErr error
+		eachPage(func(pastes []api.Paste) error {
+			if len(orphans) == 0 {
+				return nil
+			}
+			// streamed pastes are listed without a ciphertext and are
+			// skipped
+			ciphertexts := make(map[string]string, len(pastes))
+			for _, p := range pastes {
+				ciphertexts[p.ID] = p.Ciphertext
+			}
+			moved, err := crypt.RecoverKeys(keys, slices.Collect(maps.Keys(orphans)), ciphertexts)
+			for tempID := range moved {
+				delete(orphans, tempID)
+			}
+			recovered += len(moved)
+			moveErr = err
+			return err
+		})
+		if moveErr == nil && recovered == 0 {
+			return nil
+		}
+		return KeysRepairedMsg{Recovered: recovered, Err: moveErr}
+	}
+}
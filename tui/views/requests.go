@@ -0,0 +1,86 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"Drop-Key-TUI/api"
+)
+
+// inflight is the request a view is waiting on. It is cancelled when the
+// user presses esc on the spinner, leaves the tab or quits.
+type inflight struct {
+	cancel context.CancelFunc
+	retry  *retryStatus
+}
+
+// start cancels the request still running, if any, and returns the
+// context for the next one
+func (r *inflight) start() context.Context {
+	r.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.retry = &retryStatus{}
+	return api.WithRetryHook(ctx, r.retry.set)
+}
+
+// stop cancels the running request, it is a no-op when there is none
+func (r *inflight) stop() {
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	r.retry = nil
+}
+
+// running reports whether a request was started and has not been stopped
+func (r *inflight) running() bool {
+	return r.cancel != nil
+}
+
+// retrying is appended to the spinner text while the request is being
+// retried, it is empty otherwise
+func (r *inflight) retrying() string {
+	return r.retry.String()
+}
+
+// retryStatus keeps the last retry of a request. It is set from the
+// request's goroutine and read on the next spinner tick.
+type retryStatus struct {
+	mu    sync.Mutex
+	event *api.RetryEvent
+}
+
+func (s *retryStatus) set(e api.RetryEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.event = &e
+}
+
+// clear forgets the last retry once the request went through
+func (s *retryStatus) clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.event = nil
+}
+
+func (s *retryStatus) String() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.event == nil {
+		return ""
+	}
+	reason := "connection trouble"
+	if errors.Is(s.event.Err, api.ErrServerBusy) {
+		reason = "server busy"
+	}
+	return fmt.Sprintf(" (%s, retry %d of %d)", reason, s.event.Attempt-1, s.event.Attempts-1)
+}
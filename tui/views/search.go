@@ -1,23 +1,22 @@
 package views
 
 import (
-	"crypto/ed25519"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/contacts"
 	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/paste"
 	"Drop-Key-TUI/tui/styles"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
-	"github.com/charmbracelet/x/term"
 )
 
 type SearchState string
@@ -25,6 +24,7 @@ type SearchState string
 const (
 	enterID      SearchState = "enter paste id"
 	viewPaste    SearchState = "view paste"
+	nameContact  SearchState = "name contact"
 	searchErr    SearchState = "err"
 	StateFetched SearchState = "paste fetched"
 )
@@ -35,7 +35,6 @@ type SearchModel struct {
 	vp         viewport.Model
 	decrypted  string
 	fetched    bool
-	laoding    bool
 	notFound   bool
 	expired    bool
 	invalidKey bool
@@ -46,24 +45,60 @@ type SearchModel struct {
 	publicKey string
 	signature string
 	expiresAt time.Time
+	trust     crypt.TrustStatus
+	signers   *signers
+	notice    string
+	payload   *paste.Payload
+	streamed  bool
+
+	contactName textinput.Model
+
+	height int
+
+	spinner spinner.Model
+	req     inflight
+
+	store config.Store
+	keys  crypt.KeyStore
 }
 
-func NewSearchModel() *SearchModel {
-	physicalWidth, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
+func NewSearchModel(store config.Store, keys crypt.KeyStore) *SearchModel {
 	ti := textinput.New()
 	ti.Placeholder = "Enter paste URL"
 	ti.Focus()
 	ti.CharLimit = 100
 	ti.Width = 50
 
-	vp := viewport.New(physicalWidth-22, physicalHeight-12)
+	vp := viewport.New(0, 0)
 	vp.Style = styles.VpStyle
 	vp.SetContent("")
 
+	contactName := textinput.New()
+	contactName.Placeholder = "Contact name"
+	contactName.CharLimit = 40
+	contactName.Width = 30
+
+	s := spinner.New()
+	s.Style = styles.SpinnerStyle
+
 	return &SearchModel{
-		state: enterID,
-		ti:    ti,
-		vp:    vp,
+		state:       enterID,
+		spinner:     s,
+		ti:          ti,
+		vp:          vp,
+		contactName: contactName,
+		signers:     loadSigners(store),
+		store:       store,
+		keys:        keys,
+	}
+}
+
+func (m *SearchModel) SetSize(width, height int) {
+	m.height = height
+	m.vp.Width = max(width-22, 1)
+	m.vp.Height = max(height-12, 1)
+	if m.state == viewPaste && m.payload != nil && m.payload.IsText() {
+		m.UpdateViewportContent(renderableText(m.payload))
 	}
 }
 
@@ -89,39 +124,97 @@ func (m *SearchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.expired = false
 				m.invalidKey = false
 				m.decrypted = ""
-				return m, api.GetPaste(m.pasteID)
+				m.payload = nil
+				return m, tea.Batch(api.GetPaste(m.req.start(), m.pasteID), m.spinner.Tick)
 
 			case StateFetched:
-				m.decrypted = m.DecryptAndVerify(
-					m.rawCipher,
-					m.publicKey,
-					m.signature,
-					m.pasteID,
-				)
-
-				var pasteData struct {
-					Title string `json:"title"`
-					Paste string `json:"paste"`
+				m.state = viewPaste
+				m.notice = ""
+				m.signers = loadSigners(m.store)
+				if m.streamed {
+					m.trust = crypt.Unsigned
+					m.vp.SetContent("This paste is too large to view here, download it with `dropkey get -o ~/Downloads " + m.pasteID + "`")
+					return m, nil
+				}
+				opened, err := crypt.VerifyAndOpen(m.keys, m.pasteID, m.rawCipher, m.signature, m.publicKey, m.signers.Known)
+				if err != nil {
+					m.trust = crypt.Unsigned
+					m.vp.SetContent("[decrypt error: " + err.Error() + "]")
+					return m, nil
+				}
+				m.trust = opened.Status
+				if opened.Status == crypt.BadSignature {
+					m.vp.SetContent("[verify error: signature mismatch, paste was not decrypted]")
+					return m, nil
+				}
+				m.decrypted = string(opened.Plaintext)
+
+				payload, err := paste.Unmarshal(opened.Plaintext)
+				m.payload = payload
+				switch {
+				case err != nil:
+					m.vp.SetContent("[error: " + err.Error() + "]")
+				case !payload.IsText():
+					m.vp.SetContent(attachmentCard(payload))
+				default:
+					m.UpdateViewportContent(renderableText(payload))
 				}
 
-				if err := json.Unmarshal([]byte(m.decrypted), &pasteData); err != nil {
-					m.vp.SetContent("[error: invalid decrypted JSON]")
-				} else {
-					m.UpdateViewportContent(pasteData.Paste)
-					m.state = viewPaste
+				// the signer may be a contact who rotated their key since
+				// we saved them, follow the chain to find out
+				if m.trust == crypt.UnknownSigner {
+					return m, api.GetKeyHistory(m.req.start(), m.publicKey)
 				}
-				m.state = viewPaste
 				return m, nil
 			}
 
 		case tea.KeyEsc:
+			if m.loading {
+				m.req.stop()
+				m.loading = false
+				return m, nil
+			}
 			if m.state == viewPaste {
 				m.state = enterID
 			}
+			if m.state == nameContact {
+				m.contactName.Blur()
+				m.state = viewPaste
+				return m, nil
+			}
+
+		case tea.KeyCtrlA:
+			if m.state == viewPaste && m.trust != crypt.BadSignature && !m.signers.own.OwnsKey(m.publicKey) && crypt.Fingerprint(m.publicKey) != "" {
+				m.contactName.SetValue("")
+				m.contactName.Focus()
+				m.state = nameContact
+				return m, textinput.Blink
+			}
+
+		case tea.KeyCtrlV:
+			if m.state == viewPaste {
+				m.notice = m.markContactVerified()
+				return m, nil
+			}
+
+		case tea.KeyCtrlO:
+			if m.state == viewPaste && m.payload != nil && m.payload.IsAttachment() {
+				return m, saveAttachmentCmd(m.payload)
+			}
 
 		case tea.KeyCtrlC:
 			return m, tea.Quit
 		}
+		if m.state == nameContact {
+			if msg.Type == tea.KeyEnter {
+				m.notice = m.saveContact(m.contactName.Value())
+				m.contactName.Blur()
+				m.state = viewPaste
+				return m, nil
+			}
+			m.contactName, cmd = m.contactName.Update(msg)
+			return m, cmd
+		}
 		if m.state == enterID {
 			m.ti, cmd = m.ti.Update(msg)
 			return m, cmd
@@ -131,6 +224,12 @@ func (m *SearchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+	case spinner.TickMsg:
+		if m.loading {
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
 	case api.PasteFetchedMsg:
 		p := msg.Paste
 
@@ -138,12 +237,23 @@ func (m *SearchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.publicKey = p.PublicKey
 		m.signature = p.Signature
 		m.expiresAt = p.ExpiresAt
+		m.streamed = p.Streamed
 		m.fetched = true
 		m.loading = false
 		m.state = StateFetched
 
 		return m, nil
 
+	case attachmentSavedMsg:
+		m.notice = msg.notice()
+		return m, nil
+
+	case api.KeyHistoryFetchedMsg:
+		if msg.PublicKey == m.publicKey {
+			m.notice = m.followRotations(msg.Rotations)
+		}
+		return m, nil
+
 	case api.ErrMsg:
 		m.loading = false
 		err := msg.Error()
@@ -186,10 +296,15 @@ func (m *SearchModel) UpdateViewportContent(paste string) {
 	m.vp.SetContent(str)
 }
 
+// Leave cancels a fetch still running when the user switches tabs
+func (m *SearchModel) Leave() {
+	m.req.stop()
+	m.loading = false
+}
+
 func (m *SearchModel) View() string {
-	_, physicalHeight, _ := term.GetSize((os.Stdout.Fd()))
-	if m.laoding {
-		return styles.SpinnerStyle.Render("Decrypting paste...") + "\n"
+	if m.loading {
+		return "\n" + m.spinner.View() + " " + styles.SpinnerStyle.Render("Fetching paste..."+m.req.retrying()) + "\n" + styles.HelpStyle.Render("esc to cancel")
 	}
 
 	if m.notFound {
@@ -207,7 +322,7 @@ func (m *SearchModel) View() string {
 	switch m.state {
 	case enterID:
 		return "\n" + styles.HeaderStyle.Render("🔎 Search Paste by ID") + "\n\n" + m.ti.View() +
-			styles.HelpStyle.PaddingTop(physicalHeight-14).Render("Ctrl+C to quit")
+			styles.HelpStyle.PaddingTop(max(m.height-14, 0)).Render("Ctrl+C to quit")
 
 	case StateFetched:
 		info := fmt.Sprintf(
@@ -221,8 +336,24 @@ func (m *SearchModel) View() string {
 		return info + "\n" + help
 
 	case viewPaste:
-		help := styles.HelpStyle.Render("esc to return back | j, k to navigate")
-		return styles.HeaderStyle.Render("📄 Decrypted Paste") + "\n\n" + m.vp.View() + "\n" + help
+		helpText := "esc to return back | j, k to navigate | Ctrl+A save signer as contact | Ctrl+V mark contact verified"
+		if m.payload != nil && m.payload.IsAttachment() {
+			helpText += " | Ctrl+O save attachment"
+		}
+		help := styles.HelpStyle.Render(helpText)
+		header := styles.HeaderStyle.Render("📄 Decrypted Paste") + " " + m.signers.Badge(m.trust, m.publicKey)
+		if history := m.signers.History(m.publicKey); history != "" {
+			header += "\n" + history
+		}
+		if m.notice != "" {
+			header += "\n" + styles.SubtleStyle.Render(m.notice)
+		}
+		return header + "\n\n" + m.vp.View() + "\n" + help
+
+	case nameContact:
+		prompt := fmt.Sprintf("Save signer %s as:", crypt.Fingerprint(m.publicKey))
+		help := styles.HelpStyle.Render("Enter to save | esc to cancel")
+		return "\n" + styles.HeaderStyle.Render("👤 "+prompt) + "\n\n" + m.contactName.View() + "\n" + help
 	}
 
 	return m.ti.View() + styles.HelpStyle.Render("Ctrl+C to quit")
@@ -232,35 +363,66 @@ func (m *SearchModel) Title() string {
 	return "Search Pastes"
 }
 
-// DecryptAndVerify decrypts the base64 ciphertext using your AES key,
-// and verifies the signature using the provided base64 public key.
-func (m *SearchModel) DecryptAndVerify(ciphertextB64, pubKeyB64, sigB64, pasteID string) string {
-	// Decode from base64
-	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+// saveContact stores the signer of the open paste under name. A contact
+// added this way is trusted on first use until its fingerprint is compared.
+func (m *SearchModel) saveContact(name string) string {
+	book, err := contacts.Load(m.store)
 	if err != nil {
-		return "[decrypt error: invalid ciphertext]"
+		return err.Error()
+	}
+	if err := book.Add(name, m.publicKey, contacts.TOFU); err != nil {
+		return err.Error()
+	}
+	if err := book.Save(); err != nil {
+		return err.Error()
 	}
 
-	pubKey, err := base64.StdEncoding.DecodeString(pubKeyB64)
-	if err != nil {
-		return "[verify error: invalid public key]"
+	m.signers = loadSigners(m.store)
+	if m.trust == crypt.UnknownSigner {
+		m.trust = crypt.Verified
 	}
+	return "Saved " + name + ", compare the fingerprint with them and press Ctrl+V once it matches"
+}
 
-	signature, err := base64.StdEncoding.DecodeString(sigB64)
+func (m *SearchModel) markContactVerified() string {
+	book, err := contacts.Load(m.store)
 	if err != nil {
-		return "[verify error: invalid signature]"
+		return err.Error()
 	}
+	if err := book.MarkVerified(m.publicKey); err != nil {
+		return "Save the signer as a contact first (Ctrl+A)"
+	}
+	if err := book.Save(); err != nil {
+		return err.Error()
+	}
+
+	m.signers = loadSigners(m.store)
+	return "Fingerprint marked as verified"
+}
 
-	// Verify signature on pasteID + ciphertext
-	if !ed25519.Verify(pubKey, ciphertext, signature) {
-		return "[verify error: signature mismatch]"
+// followRotations moves contacts onto the keys they rotated to, so a paste
+// signed with a contact's new key is attributed to them.
+func (m *SearchModel) followRotations(rotations []api.KeyRotation) string {
+	statements := make([]crypt.RotationStatement, len(rotations))
+	for i, r := range rotations {
+		statements[i] = r.Statement()
 	}
 
-	// Decrypt using your AES key
-	plaintext, err := crypt.DecryptPaste(m.pasteID, ciphertextB64)
+	book, err := contacts.Load(m.store)
 	if err != nil {
-		return "[decrypt error: " + err.Error() + "]"
+		return err.Error()
+	}
+	changed := book.ApplyRotations(statements)
+	if len(changed) == 0 {
+		return ""
+	}
+	if err := book.Save(); err != nil {
+		return err.Error()
 	}
 
-	return string(plaintext)
+	m.signers = loadSigners(m.store)
+	if m.signers.Known(m.publicKey) {
+		m.trust = crypt.Verified
+	}
+	return fmt.Sprintf("%s rotated their key, the new key was endorsed by the old one", changed[0].Name)
 }
@@ -0,0 +1,690 @@
+package views
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/backup"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/doctor"
+	"Drop-Key-TUI/drafts"
+	"Drop-Key-TUI/tui/styles"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type settingsState string
+
+const (
+	settingsMenu        settingsState = "settings menu"
+	confirmRotation     settingsState = "confirm key rotation"
+	rotatingKey         settingsState = "rotating key"
+	settingsDone        settingsState = "settings action done"
+	settingsErr         settingsState = "settings error"
+	backupPath          settingsState = "entering backup path"
+	backupPass          settingsState = "entering backup passphrase"
+	backupConfirm       settingsState = "confirming backup passphrase"
+	backupRunning       settingsState = "running backup"
+	confirmQR           settingsState = "confirm identity QR"
+	showingQR           settingsState = "showing identity QR"
+	checkingKeys        settingsState = "checking paste keys"
+	keysReport          settingsState = "showing key report"
+	showingNewPhrase    settingsState = "showing new recovery phrase"
+	confirmingNewPhrase settingsState = "confirming new recovery phrase"
+)
+
+const (
+	actionRotateKey     = "Rotate identity key"
+	actionExportBackup  = "Export backup"
+	actionRestoreBackup = "Restore backup"
+	actionShowQR        = "Show identity QR"
+	actionCheckKeys     = "Check paste keys"
+)
+
+const defaultBackupFile = "dropkey-backup.dkb"
+
+type SettingsModel struct {
+	currentState settingsState
+	list         list.Model
+	token        string
+	status       string
+
+	width, height int
+
+	// action is the menu entry whose inputs are being collected
+	action     string
+	pathInput  textinput.Model
+	passInput  textinput.Model
+	passphrase string
+
+	// phrase is only held while the QR screen is up
+	phrase string
+
+	// recovery phrase of a rotated key, cleared once confirmed
+	newPhrase    []string
+	phraseChecks []int
+	phraseStep   int
+	phraseInput  textinput.Model
+	phraseNotice string
+
+	report *doctor.Report
+	// req is the key check while it runs. Rotations are not cancellable,
+	// the server may record one after the client gave up on it.
+	req inflight
+
+	store config.Store
+	keys  crypt.KeyStore
+}
+
+type identityPhraseMsg struct {
+	phrase string
+}
+
+type backupDoneMsg struct {
+	status string
+}
+
+type keysCheckedMsg struct {
+	report *doctor.Report
+}
+
+type keysShreddedMsg struct {
+	deleted int
+}
+
+// keyRotatedMsg is a rotation that was recorded and saved, with the
+// recovery phrase of the new key
+type keyRotatedMsg struct {
+	api.KeyRotatedMsg
+	phrase  []string
+	warning string
+}
+
+func NewSettingsModel(store config.Store, keys crypt.KeyStore) *SettingsModel {
+	items := []list.Item{
+		item{title: actionRotateKey, desc: "Replace your key pair, the old key endorses the new one."},
+		item{title: actionExportBackup, desc: "Save your identity and paste keys to a passphrase-encrypted file."},
+		item{title: actionRestoreBackup, desc: "Merge a backup file into this install without overwriting keys."},
+		item{title: actionShowQR, desc: "Show your recovery phrase as a QR code to move it to another device."},
+		item{title: actionCheckKeys, desc: "Compare your paste keys with the server and delete the keys of expired pastes."},
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 60, 16)
+	l.Title = "Account settings"
+	l.SetShowStatusBar(false)
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	l.Styles.Title = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("218"))
+
+	pathInput := textinput.New()
+	pathInput.Placeholder = "Backup file path"
+	pathInput.Width = 50
+
+	passInput := textinput.New()
+	passInput.Placeholder = "Passphrase"
+	passInput.EchoMode = textinput.EchoPassword
+	passInput.EchoCharacter = '•'
+	passInput.Width = 50
+
+	phraseInput := textinput.New()
+	phraseInput.Placeholder = "word"
+	phraseInput.CharLimit = 16
+	phraseInput.Width = 20
+
+	return &SettingsModel{
+		currentState: settingsMenu,
+		list:         l,
+		pathInput:    pathInput,
+		passInput:    passInput,
+		phraseInput:  phraseInput,
+		store:        store,
+		keys:         keys,
+	}
+}
+
+func (m *SettingsModel) SetSize(width, height int) {
+	m.width = width
+	m.height = height
+}
+
+func (m *SettingsModel) SetToken(token string) {
+	m.token = token
+}
+
+func (m *SettingsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *SettingsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch m.currentState {
+		case settingsMenu:
+			if msg.String() == "enter" {
+				selected, ok := m.list.SelectedItem().(item)
+				if !ok {
+					return m, nil
+				}
+				m.action = selected.title
+				switch selected.title {
+				case actionRotateKey:
+					m.currentState = confirmRotation
+				case actionExportBackup, actionRestoreBackup:
+					m.pathInput.SetValue(defaultBackupPath())
+					m.pathInput.Focus()
+					m.currentState = backupPath
+					return m, textinput.Blink
+				case actionShowQR:
+					m.currentState = confirmQR
+				case actionCheckKeys:
+					m.currentState = checkingKeys
+					return m, checkKeysCmd(m.req.start(), m.store, m.keys)
+				}
+				return m, nil
+			}
+
+		case backupPath, backupPass, backupConfirm:
+			return m.updateBackupInputs(msg)
+
+		case confirmRotation:
+			switch msg.String() {
+			case "y":
+				m.currentState = rotatingKey
+				return m, rotateIdentityCmd(m.store, m.token)
+			case "n", "esc":
+				m.currentState = settingsMenu
+			}
+			return m, nil
+
+		case confirmQR:
+			switch msg.String() {
+			case "y":
+				return m, identityPhraseCmd(m.store)
+			case "n", "esc":
+				m.currentState = settingsMenu
+			}
+			return m, nil
+
+		case showingQR:
+			m.phrase = ""
+			m.currentState = settingsMenu
+			return m, nil
+
+		case showingNewPhrase:
+			if msg.String() == "enter" {
+				m.phraseChecks = pickPhraseChecks()
+				m.phraseStep = 0
+				m.phraseNotice = ""
+				m.phraseInput.SetValue("")
+				m.phraseInput.Focus()
+				m.currentState = confirmingNewPhrase
+				return m, textinput.Blink
+			}
+			return m, nil
+
+		case confirmingNewPhrase:
+			if msg.String() == "enter" {
+				return m.checkPhraseWord()
+			}
+			var cmd tea.Cmd
+			m.phraseInput, cmd = m.phraseInput.Update(msg)
+			return m, cmd
+
+		case keysReport:
+			expired := m.report.Expired()
+			m.report = nil
+			if msg.String() == "d" && len(expired) > 0 {
+				m.currentState = checkingKeys
+				return m, shredKeysCmd(m.keys, expired)
+			}
+			m.currentState = settingsMenu
+			return m, nil
+
+		case settingsDone, settingsErr:
+			m.currentState = settingsMenu
+			return m, nil
+
+		case checkingKeys:
+			if msg.String() == "esc" && m.req.running() {
+				m.req.stop()
+				m.currentState = settingsMenu
+			}
+			return m, nil
+
+		case rotatingKey, backupRunning:
+			return m, nil
+		}
+
+	case identityPhraseMsg:
+		m.phrase = msg.phrase
+		m.currentState = showingQR
+		return m, nil
+
+	case backupDoneMsg:
+		m.currentState = settingsDone
+		m.status = msg.status
+		return m, nil
+
+	case keysCheckedMsg:
+		m.req.stop()
+		m.report = msg.report
+		m.currentState = keysReport
+		return m, nil
+
+	case keysShreddedMsg:
+		m.currentState = settingsDone
+		m.status = fmt.Sprintf("Deleted %d expired keys", msg.deleted)
+		return m, nil
+
+	case keyRotatedMsg:
+		m.status = fmt.Sprintf("Key rotated. New fingerprint: %s\nOld fingerprint %s is kept to verify your earlier pastes.",
+			crypt.Fingerprint(msg.NewPublicKey), crypt.Fingerprint(msg.OldPublicKey))
+		if msg.warning != "" {
+			m.status += "\n" + msg.warning
+		}
+		m.newPhrase = msg.phrase
+		m.phraseNotice = ""
+		m.currentState = showingNewPhrase
+		return m, nil
+
+	case api.ErrMsg:
+		m.req.stop()
+		m.currentState = settingsErr
+		m.status = msg.Error()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m *SettingsModel) View() string {
+	var b strings.Builder
+	b.WriteString("\n")
+
+	switch m.currentState {
+	case settingsMenu:
+		b.WriteString(m.list.View())
+		b.WriteString("\n" + styles.HelpStyle.Render("Enter to select | tab to switch tabs | Ctrl+X to logout"))
+
+	case confirmRotation:
+		b.WriteString(styles.HeaderStyle.Render("🔁 Rotate identity key"))
+		b.WriteString("\n\nA new key pair will replace the current one. Your contacts can follow\n")
+		b.WriteString("the rotation because the current key signs an endorsement of the new key.\n")
+		b.WriteString(styles.HelpStyle.Render("Press y to rotate, n to cancel"))
+
+	case rotatingKey:
+		b.WriteString(styles.SpinnerStyle.Render("Rotating identity key..."))
+
+	case backupPath:
+		b.WriteString(styles.HeaderStyle.Render("💾 " + m.action))
+		b.WriteString("\n\nBackup file:\n" + m.pathInput.View())
+		b.WriteString("\n" + styles.HelpStyle.Render("Enter to continue | esc to cancel"))
+
+	case backupPass, backupConfirm:
+		prompt := "Passphrase:"
+		if m.currentState == backupConfirm {
+			prompt = "Repeat passphrase:"
+		}
+		b.WriteString(styles.HeaderStyle.Render("💾 " + m.action))
+		b.WriteString("\n\n" + prompt + "\n" + m.passInput.View())
+		b.WriteString("\n" + styles.HelpStyle.Render("Enter to continue | esc to cancel"))
+
+	case backupRunning:
+		b.WriteString(styles.SpinnerStyle.Render("Working on backup..."))
+
+	case confirmQR:
+		b.WriteString(styles.HeaderStyle.Render("📱 Show identity QR"))
+		b.WriteString("\n\n" + styles.ErrStyle.Render("The code contains your recovery phrase. Anyone who scans it can sign as you."))
+		b.WriteString("\nMake sure nobody is looking at your screen and it is not being recorded.\n")
+		b.WriteString(styles.HelpStyle.Render("Press y to show the code, n to cancel"))
+
+	case showingQR:
+		b.WriteString(styles.ErrStyle.Render("⚠ Secret: scan only with a device you trust"))
+		b.WriteString("\n\n" + qrOrHint(m.phrase, m.width-4, m.height-12))
+		b.WriteString("\n" + styles.HelpStyle.Render("Press any key to hide the code"))
+
+	case showingNewPhrase:
+		b.WriteString(styles.HeaderStyle.Render("🔁 Key rotated"))
+		b.WriteString("\n\nYour old recovery phrase no longer restores this identity. Write down the\n")
+		b.WriteString("words of the new key in order and keep them somewhere safe:\n\n")
+		b.WriteString(renderPhrase(m.newPhrase))
+		if m.phraseNotice != "" {
+			b.WriteString("\n" + styles.ErrStyle.Render(m.phraseNotice) + "\n")
+		}
+		b.WriteString("\n" + styles.HelpStyle.Render("Press Enter once you have written them down"))
+
+	case confirmingNewPhrase:
+		b.WriteString(styles.HeaderStyle.Render(fmt.Sprintf("🔁 Confirm your new recovery phrase (%d/%d)", m.phraseStep+1, len(m.phraseChecks))))
+		b.WriteString(fmt.Sprintf("\n\nWord #%d:\n", m.phraseChecks[m.phraseStep]+1))
+		b.WriteString(m.phraseInput.View())
+		b.WriteString("\n" + styles.HelpStyle.Render("Press Enter to check"))
+
+	case checkingKeys:
+		b.WriteString(styles.SpinnerStyle.Render("Checking paste keys..."))
+		if m.req.running() {
+			b.WriteString("\n" + styles.HelpStyle.Render("esc to cancel"))
+		}
+
+	case keysReport:
+		b.WriteString(styles.HeaderStyle.Render("🩺 " + actionCheckKeys))
+		b.WriteString("\n\n" + m.report.String())
+		if n := len(m.report.Expired()); n > 0 {
+			b.WriteString(styles.HelpStyle.Render(fmt.Sprintf("Press d to securely delete the %d expired keys, any other key to go back", n)))
+		} else {
+			b.WriteString(styles.HelpStyle.Render("Press any key to continue..."))
+		}
+
+	case settingsDone:
+		b.WriteString(styles.SuccessHeaderStyle.Render("✔ " + m.status))
+		b.WriteString("\n" + styles.HelpStyle.Render("Press any key to continue..."))
+
+	case settingsErr:
+		b.WriteString(styles.ErrStyle.Render("✘ " + m.status))
+		b.WriteString("\n" + styles.HelpStyle.Render("Press any key to continue..."))
+	}
+
+	return b.String()
+}
+
+// updateBackupInputs collects the file path and passphrase for an export
+// or restore. Exports ask for the passphrase twice.
+func (m *SettingsModel) updateBackupInputs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.resetBackupInputs()
+		m.currentState = settingsMenu
+		return m, nil
+
+	case "enter":
+		switch m.currentState {
+		case backupPath:
+			if strings.TrimSpace(m.pathInput.Value()) == "" {
+				return m, nil
+			}
+			m.pathInput.Blur()
+			m.passInput.Focus()
+			m.currentState = backupPass
+			return m, textinput.Blink
+
+		case backupPass:
+			m.passphrase = m.passInput.Value()
+			m.passInput.SetValue("")
+			if m.passphrase == "" {
+				return m, nil
+			}
+			if m.action == actionExportBackup {
+				m.currentState = backupConfirm
+				return m, nil
+			}
+			return m.runBackup()
+
+		case backupConfirm:
+			if m.passInput.Value() != m.passphrase {
+				m.resetBackupInputs()
+				m.currentState = settingsErr
+				m.status = "passphrases do not match"
+				return m, nil
+			}
+			return m.runBackup()
+		}
+	}
+
+	var cmd tea.Cmd
+	if m.currentState == backupPath {
+		m.pathInput, cmd = m.pathInput.Update(msg)
+	} else {
+		m.passInput, cmd = m.passInput.Update(msg)
+	}
+	return m, cmd
+}
+
+// checkPhraseWord compares the typed word with the new phrase. A wrong word
+// sends the user back to the phrase, the right last word finishes the rotation.
+func (m *SettingsModel) checkPhraseWord() (tea.Model, tea.Cmd) {
+	want := m.newPhrase[m.phraseChecks[m.phraseStep]]
+	got := strings.ToLower(strings.TrimSpace(m.phraseInput.Value()))
+	m.phraseInput.SetValue("")
+
+	if got != want {
+		m.phraseNotice = fmt.Sprintf("Word #%d did not match, check what you wrote down.", m.phraseChecks[m.phraseStep]+1)
+		m.phraseInput.Blur()
+		m.currentState = showingNewPhrase
+		return m, nil
+	}
+
+	m.phraseStep++
+	if m.phraseStep < len(m.phraseChecks) {
+		return m, nil
+	}
+
+	m.newPhrase = nil
+	m.phraseChecks = nil
+	m.phraseInput.Blur()
+	m.currentState = settingsDone
+	return m, nil
+}
+
+func (m *SettingsModel) runBackup() (tea.Model, tea.Cmd) {
+	path := expandHome(m.pathInput.Value())
+	passphrase := []byte(m.passphrase)
+	action := m.action
+	m.resetBackupInputs()
+	m.currentState = backupRunning
+
+	if action == actionExportBackup {
+		return m, exportBackupCmd(m.store, m.keys, path, passphrase)
+	}
+	return m, restoreBackupCmd(m.store, m.keys, path, passphrase)
+}
+
+func (m *SettingsModel) resetBackupInputs() {
+	m.passphrase = ""
+	m.passInput.SetValue("")
+	m.passInput.Blur()
+	m.pathInput.Blur()
+}
+
+func defaultBackupPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return defaultBackupFile
+	}
+	return filepath.Join(home, defaultBackupFile)
+}
+
+func exportBackupCmd(store config.Store, keys crypt.KeyStore, path string, passphrase []byte) tea.Cmd {
+	return func() tea.Msg {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		defer f.Close()
+
+		manifest, err := backup.Export(store, keys, f, passphrase)
+		if err != nil {
+			os.Remove(path)
+			return api.ErrMsg(err)
+		}
+		return backupDoneMsg{
+			status: fmt.Sprintf("Backed up identity %s and %d paste keys to %s", manifest.Fingerprint, len(manifest.Files)-1, path),
+		}
+	}
+}
+
+func restoreBackupCmd(store config.Store, keys crypt.KeyStore, path string, passphrase []byte) tea.Cmd {
+	return func() tea.Msg {
+		f, err := os.Open(path)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		defer f.Close()
+
+		report, err := backup.Import(store, keys, f, passphrase)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		return backupDoneMsg{status: strings.TrimSpace(report.String())}
+	}
+}
+
+func checkKeysCmd(ctx context.Context, store config.Store, keys crypt.KeyStore) tea.Cmd {
+	return func() tea.Msg {
+		report, err := doctor.Check(ctx, store, keys)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		return keysCheckedMsg{report: report}
+	}
+}
+
+func shredKeysCmd(keys crypt.KeyStore, ids []string) tea.Cmd {
+	return func() tea.Msg {
+		n, err := doctor.Shred(keys, ids)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		return keysShreddedMsg{deleted: n}
+	}
+}
+
+// Leave cancels a key check still running when the user switches tabs
+func (m *SettingsModel) Leave() {
+	if m.req.running() {
+		m.req.stop()
+		m.currentState = settingsMenu
+	}
+}
+
+func (m *SettingsModel) Title() string {
+	return "Settings"
+}
+
+// rotateIdentityCmd generates a new identity key, has the current key
+// endorse it and records the rotation with the server. The config is only
+// updated once the server accepted the rotation.
+func rotateIdentityCmd(store config.Store, token string) tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := store.Load()
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		userID, err := store.LoadUserID()
+		if err != nil {
+			return api.ErrMsg(fmt.Errorf("could not load user ID: %w", err))
+		}
+
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		newPublicKey := base64.StdEncoding.EncodeToString(pub)
+		newPrivateKey := base64.StdEncoding.EncodeToString(priv)
+
+		statement := crypt.RotationStatement{
+			UserID:       userID,
+			OldPublicKey: cfg.PublicKey,
+			NewPublicKey: newPublicKey,
+			RotatedAt:    time.Now().UTC().Truncate(time.Second),
+		}
+		endorsement, err := statement.Sign(cfg.PrivateKey)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		proof, err := statement.Sign(newPrivateKey)
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+
+		rotation := api.KeyRotation{
+			UserID:          statement.UserID,
+			OldPublicKey:    statement.OldPublicKey,
+			NewPublicKey:    statement.NewPublicKey,
+			RotatedAt:       statement.RotatedAt,
+			Signature:       endorsement,
+			NewKeySignature: proof,
+		}
+		return submitRotationCmd(store, rotation, newPrivateKey, token)()
+	}
+}
+
+// submitRotationCmd sends the rotation and swaps the keys in the config
+// once the server recorded it. On a 401 the same rotation is retried with
+// a fresh token so the generated key is not lost.
+func submitRotationCmd(store config.Store, rotation api.KeyRotation, newPrivateKey, token string) tea.Cmd {
+	return func() tea.Msg {
+		// the phrase is worked out first, a rotation the user cannot write
+		// down should not reach the server
+		priv, err := base64.StdEncoding.DecodeString(newPrivateKey)
+		if err != nil || len(priv) != ed25519.PrivateKeySize {
+			return api.ErrMsg(fmt.Errorf("generated private key is invalid"))
+		}
+		phrase, err := crypt.SeedToMnemonic(ed25519.PrivateKey(priv).Seed())
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+
+		switch msg := api.RotateKey(context.Background(), rotation, token)().(type) {
+		case api.KeyRotatedMsg:
+			cfg, err := store.Load()
+			if err != nil {
+				return api.ErrMsg(err)
+			}
+			oldPrivateKey := cfg.PrivateKey
+			cfg.Rotate(rotation.NewPublicKey, newPrivateKey, rotation.Signature, rotation.RotatedAt)
+			if err := store.Save(cfg); err != nil {
+				return api.ErrMsg(fmt.Errorf("server recorded the rotation but the new key could not be saved: %w", err))
+			}
+			rotated := keyRotatedMsg{KeyRotatedMsg: msg, phrase: phrase}
+			// the new key is saved by now, so its phrase is shown either way
+			if err := drafts.Rewrap(store, oldPrivateKey, newPrivateKey); err != nil {
+				rotated.warning = fmt.Sprintf("Your drafts could not be moved to the new key: %v", err)
+			}
+			return rotated
+
+		case api.UnauthorizedMsg:
+			return api.UnauthorizedMsg{
+				Retry: func(token string) tea.Cmd {
+					return submitRotationCmd(store, rotation, newPrivateKey, token)
+				},
+			}
+
+		default:
+			return msg
+		}
+	}
+}
+
+// identityPhraseCmd turns the configured private key back into its
+// recovery phrase for the QR screen.
+func identityPhraseCmd(store config.Store) tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := store.Load()
+		if err != nil {
+			return api.ErrMsg(fmt.Errorf("failed to load config: %w", err))
+		}
+
+		priv, err := base64.StdEncoding.DecodeString(cfg.PrivateKey)
+		if err != nil || len(priv) != ed25519.PrivateKeySize {
+			return api.ErrMsg(fmt.Errorf("configured private key is invalid"))
+		}
+
+		words, err := crypt.SeedToMnemonic(ed25519.PrivateKey(priv).Seed())
+		if err != nil {
+			return api.ErrMsg(err)
+		}
+		return identityPhraseMsg{phrase: strings.Join(words, " ")}
+	}
+}
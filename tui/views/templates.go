@@ -0,0 +1,135 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/templates"
+	"Drop-Key-TUI/tui/styles"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type templatesLoadedMsg struct {
+	// dir is where the list was read from, shown so users know where to
+	// add their own
+	dir  string
+	list []templates.Template
+	err  error
+}
+
+type templateItem struct {
+	templates.Template
+}
+
+func (t templateItem) Title() string { return t.Name }
+
+func (t templateItem) Description() string {
+	if n := len(t.Prompts()); n > 0 {
+		return fmt.Sprintf("%s · asks %d question(s)", t.Template.Title, n)
+	}
+	return t.Template.Title
+}
+
+func (t templateItem) FilterValue() string { return t.Name }
+
+func loadTemplatesCmd(store config.Store) tea.Cmd {
+	return func() tea.Msg {
+		dir, err := templates.Dir(store)
+		if err != nil {
+			return templatesLoadedMsg{err: err}
+		}
+		list, err := templates.List(dir)
+		return templatesLoadedMsg{dir: dir, list: list, err: err}
+	}
+}
+
+// updateTemplatePicker handles keys while the template list is shown
+func (m *PasteFormModel) updateTemplatePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.currentState = m.templateReturn
+		m.textarea.Focus()
+		return m, nil
+
+	case "enter":
+		t, ok := m.templateList.SelectedItem().(templateItem)
+		if !ok {
+			return m, nil
+		}
+		m.template = &t.Template
+		m.prompts = t.Prompts()
+		m.answers = map[string]string{}
+		if len(m.prompts) == 0 {
+			m.applyTemplate()
+			return m, nil
+		}
+		m.askNextPrompt()
+		m.currentState = fillingTemplate
+		return m, textinput.Blink
+	}
+
+	var cmd tea.Cmd
+	m.templateList, cmd = m.templateList.Update(msg)
+	return m, cmd
+}
+
+// updateTemplatePrompt collects the answer to each custom prompt in turn
+func (m *PasteFormModel) updateTemplatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.promptInput.Blur()
+		m.template = nil
+		m.currentState = m.templateReturn
+		m.textarea.Focus()
+		return m, nil
+
+	case "enter":
+		m.answers[m.prompts[0]] = m.promptInput.Value()
+		m.prompts = m.prompts[1:]
+		if len(m.prompts) == 0 {
+			m.promptInput.Blur()
+			m.applyTemplate()
+			return m, nil
+		}
+		m.askNextPrompt()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.promptInput, cmd = m.promptInput.Update(msg)
+	return m, cmd
+}
+
+func (m *PasteFormModel) askNextPrompt() {
+	m.promptInput.SetValue("")
+	m.promptInput.Placeholder = m.prompts[0]
+	m.promptInput.Focus()
+}
+
+// applyTemplate fills the title bar and holds the body until the title is
+// confirmed. Whatever was being written can be brought back with alt+u.
+func (m *PasteFormModel) applyTemplate() {
+	title, body := m.template.Fill(m.answers, time.Now())
+	m.keepUndo()
+	m.template = nil
+	m.answers = nil
+	m.attachment = nil
+	m.draftID = ""
+
+	m.textarea.SetValue("")
+	m.titleBar.SetValue(title)
+	m.titleBar.Focus()
+	m.templateBody = body
+	m.currentState = decidingTitle
+}
+
+func (m *PasteFormModel) renderTemplatePrompt() string {
+	answered := len(m.answers)
+	header := fmt.Sprintf("📋 %s (%d/%d)", strings.TrimSuffix(m.prompts[0], ":"), answered+1, answered+len(m.prompts))
+	return styles.HeaderStyle.Render(header) + "\n\n" + m.promptInput.View() +
+		"\n" + styles.HelpStyle.Render("Enter for the next question | esc to cancel")
+}
@@ -0,0 +1,155 @@
+package views
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/paste"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// titleWorkers bounds how many pastes are decrypted at once, however long
+// the list is
+var titleWorkers = min(runtime.NumCPU(), 4)
+
+// pendingTitle is shown until the title of a row is decrypted
+const pendingTitle = "🔐 Decrypting..."
+
+type decryptedTitle struct {
+	index int
+	title string
+	trust crypt.TrustStatus
+}
+
+// titlesDecryptedMsg carries the titles of one page that were ready since
+// the last one. gen tells results of an earlier fetch apart, they are
+// dropped.
+type titlesDecryptedMsg struct {
+	gen     int
+	titles  []decryptedTitle
+	done    bool
+	results <-chan decryptedTitle
+}
+
+// decryptTitles decrypts the titles of a page on a pool of titleWorkers
+// goroutines, first is the list index of pastes[0]. Results arrive on the
+// returned channel in the order they finish, and it is closed once every
+// title is done or ctx is cancelled.
+func decryptTitles(ctx context.Context, keys crypt.KeyStore, signers *signers, first int, pastes []api.Paste) <-chan decryptedTitle {
+	jobs := make(chan int)
+	results := make(chan decryptedTitle, titleWorkers)
+
+	var wg sync.WaitGroup
+	for range titleWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				title, trust := decryptTitle(keys, signers, pastes[i])
+				select {
+				case results <- decryptedTitle{index: first + i, title: title, trust: trust}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range pastes {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// nextTitles waits for the next decrypted title and takes whatever else
+// is ready with it, so a fast pool does not flood the update loop
+func nextTitles(gen int, results <-chan decryptedTitle) tea.Cmd {
+	return func() tea.Msg {
+		first, ok := <-results
+		if !ok {
+			return titlesDecryptedMsg{gen: gen, done: true, results: results}
+		}
+		msg := titlesDecryptedMsg{gen: gen, titles: []decryptedTitle{first}, results: results}
+		for {
+			select {
+			case t, ok := <-results:
+				if !ok {
+					msg.done = true
+					return msg
+				}
+				msg.titles = append(msg.titles, t)
+			default:
+				return msg
+			}
+		}
+	}
+}
+
+// decryptTitle reads the title of one paste. The signature is checked
+// without decrypting, and only the title header is opened. The paste
+// signature does not cover the header, so it is only used when its own
+// signature from the same signer checks out. Pastes from clients that did
+// not write a signed header fall back to decrypting the body.
+func decryptTitle(keys crypt.KeyStore, signers *signers, p api.Paste) (string, crypt.TrustStatus) {
+	trust := crypt.Unsigned
+	if !p.Streamed {
+		// streamed pastes are only verified on download, see
+		// paste.OpenStream
+		trust = crypt.Verify(p.Ciphertext, p.Signature, p.PublicKey, signers.Known)
+		if trust == crypt.BadSignature {
+			return "Signature mismatch", trust
+		}
+	}
+
+	if p.TitleHeader != "" && p.TitleSignature != "" {
+		if crypt.VerifyTitle(p.TitleHeader, p.TitleSignature, p.PublicKey, nil) == crypt.BadSignature {
+			return "Signature mismatch", crypt.BadSignature
+		}
+		header, err := paste.OpenTitle(keys, p.ID, p.TitleHeader)
+		if err != nil {
+			// the signature says nothing about having the key, keep
+			// what it said
+			return "Error decrypting", trust
+		}
+		return listTitle(header.Title, header.IsAttachment(), p.Streamed), trust
+	}
+	if p.Streamed {
+		return "📦 Streamed paste", trust
+	}
+
+	opened, err := crypt.VerifyAndOpen(keys, p.ID, p.Ciphertext, p.Signature, p.PublicKey, signers.Known)
+	if err != nil {
+		return "Error decrypting", trust
+	}
+	payload, err := paste.Unmarshal(opened.Plaintext)
+	if err != nil {
+		return "Invalid payload", trust
+	}
+	return listTitle(payload.Title, payload.IsAttachment(), false), trust
+}
+
+func listTitle(title string, attachment, streamed bool) string {
+	switch {
+	case streamed:
+		return "📦 " + title
+	case attachment:
+		return "📎 " + title
+	}
+	return title
+}
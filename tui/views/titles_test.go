@@ -0,0 +1,63 @@
+package views
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"Drop-Key-TUI/api"
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/contacts"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/paste"
+)
+
+func TestDecryptTitleNeedsSignedHeader(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	cfg := &config.Config{
+		PublicKey:  base64.StdEncoding.EncodeToString(pub),
+		PrivateKey: base64.StdEncoding.EncodeToString(priv),
+	}
+	known := &signers{own: cfg, book: &contacts.Book{}}
+	keys := crypt.NewMemoryKeyStore()
+
+	sealed, err := paste.Seal(keys, paste.Text("shopping", "milk, eggs"), paste.None, cfg.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := api.Paste{
+		ID:             sealed.TempID,
+		Ciphertext:     sealed.Ciphertext,
+		Signature:      sealed.Signature,
+		PublicKey:      cfg.PublicKey,
+		TitleHeader:    sealed.TitleHeader,
+		TitleSignature: sealed.TitleSignature,
+	}
+
+	// anyone holding the paste key can seal a header of their own, but
+	// not sign it as the author
+	forged, err := crypt.SealTitle(keys, sealed.TempID, []byte(`{"title":"forged"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := signed
+	swapped.TitleHeader = forged
+	unsigned := swapped
+	unsigned.TitleSignature = ""
+
+	tests := map[string]struct {
+		paste api.Paste
+		title string
+		trust crypt.TrustStatus
+	}{
+		"signed header":   {signed, "shopping", crypt.Verified},
+		"swapped header":  {swapped, "Signature mismatch", crypt.BadSignature},
+		"unsigned header": {unsigned, "shopping", crypt.Verified},
+	}
+	for name, tt := range tests {
+		title, trust := decryptTitle(keys, known, tt.paste)
+		if title != tt.title || trust != tt.trust {
+			t.Errorf("%s: got %q, %v, want %q, %v", name, title, trust, tt.title, tt.trust)
+		}
+	}
+}
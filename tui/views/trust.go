@@ -0,0 +1,87 @@
+package views
+
+import (
+	"fmt"
+
+	"Drop-Key-TUI/config"
+	"Drop-Key-TUI/contacts"
+	"Drop-Key-TUI/crypt"
+	"Drop-Key-TUI/tui/styles"
+)
+
+// signers knows which public keys belong to the user and their contacts.
+// It is loaded once so the checks stay cheap when they run for every paste
+// in a list.
+type signers struct {
+	own  *config.Config
+	book *contacts.Book
+}
+
+func loadSigners(store config.Store) *signers {
+	s := &signers{own: &config.Config{}, book: &contacts.Book{}}
+	if cfg, err := store.Load(); err == nil {
+		s.own = cfg
+	}
+	if book, err := contacts.Load(store); err == nil {
+		s.book = book
+	}
+	return s
+}
+
+// Known is passed to crypt.VerifyAndOpen as the known-signer check.
+func (s *signers) Known(publicKeyB64 string) bool {
+	if s.own.OwnsKey(publicKeyB64) {
+		return true
+	}
+	_, ok := s.book.Lookup(publicKeyB64)
+	return ok
+}
+
+// Badge renders the provenance of a paste next to its title, naming the
+// signer when it is the user or one of their contacts.
+func (s *signers) Badge(status crypt.TrustStatus, publicKeyB64 string) string {
+	fingerprint := crypt.Fingerprint(publicKeyB64)
+
+	switch status {
+	case crypt.Verified:
+		if publicKeyB64 == s.own.PublicKey {
+			return styles.TrustedStyle.Render("✔ signed by you · " + fingerprint)
+		}
+		if s.own.OwnsKey(publicKeyB64) {
+			return styles.TrustedStyle.Render("✔ signed by you (previous key) · " + fingerprint)
+		}
+		if c, ok := s.book.Lookup(publicKeyB64); ok {
+			trust := string(c.Trust)
+			if !c.IsCurrent(publicKeyB64) {
+				trust += ", previous key"
+			}
+			label := fmt.Sprintf("✔ signed by %s (%s) · %s", c.Name, trust, fingerprint)
+			if c.Trust == contacts.Verified {
+				return styles.TrustedStyle.Render(label)
+			}
+			return styles.MetaStyle.Render(label)
+		}
+		return styles.TrustedStyle.Render("✔ verified · " + fingerprint)
+	case crypt.UnknownSigner:
+		return styles.UntrustedStyle.Render("? unknown signer · " + fingerprint)
+	case crypt.BadSignature:
+		return styles.ErrorStyle.Render("✘ bad signature")
+	default:
+		return styles.SubtleStyle.Render("○ unsigned")
+	}
+}
+
+// History renders the rotation chain of the contact owning publicKeyB64,
+// or an empty string when there is none.
+func (s *signers) History(publicKeyB64 string) string {
+	c, ok := s.book.Lookup(publicKeyB64)
+	if !ok || len(c.History) == 0 {
+		return ""
+	}
+
+	chain := ""
+	for _, h := range c.History {
+		chain += fmt.Sprintf("%s (until %s) → ", h.Fingerprint, h.RotatedAt.Format("2006-01-02"))
+	}
+	return styles.SubtleStyle.Render("key history: " + chain + c.Fingerprint)
+}